@@ -4,9 +4,9 @@ import (
 	"context"
 	"os"
 
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
 	gw "github.com/norseto/openai-gateway"
 	"github.com/norseto/openai-gateway/internal/gateway"
-	"github.com/norseto/k8s-watchdogs/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -14,10 +14,12 @@ func main() {
 	ctx := context.Background()
 
 	var rootCmd = &cobra.Command{
-		Use:   "openai-gateway",
-		Short: "An OpenAI API gateway",
-		Long:  `An OpenAI API gateway that provides additional features like request/response logging and token usage tracking.`,
+		Use:     "openai-gateway",
+		Short:   "An OpenAI API gateway",
+		Long:    `An OpenAI API gateway that provides additional features like request/response logging and token usage tracking.`,
+		Version: gateway.VersionString(),
 	}
+	rootCmd.SetVersionTemplate("openai-gateway {{.Version}}\n")
 	rootCmd.SetContext(ctx)
 	logger.InitCmdLogger(rootCmd, func(cmd *cobra.Command, args []string) {
 		logger.FromContext(cmd.Context()).Info("Starting OpenAI Gateway", "version", gw.RELEASE_VERSION, "git_version", gw.GitVersion)
@@ -25,6 +27,9 @@ func main() {
 
 	rootCmd.AddCommand(gateway.NewServeCommand())
 	rootCmd.AddCommand(gateway.NewQuitCommand())
+	rootCmd.AddCommand(gateway.NewVersionCommand())
+	rootCmd.AddCommand(gateway.NewSelftestCommand())
+	rootCmd.AddCommand(gateway.NewBenchCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		log := logger.FromContext(rootCmd.Context())
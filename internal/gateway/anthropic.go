@@ -0,0 +1,293 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// anthropicMessagesPath is the Anthropic Messages endpoint served with
+// Config.EnableAnthropic.
+const anthropicMessagesPath = "/v1/messages"
+
+// Anthropic Messages Request Structure
+type AnthropicMessagesRequest struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	// System is either a string or an array of text blocks.
+	System   json.RawMessage    `json:"system,omitempty"`
+	Messages []AnthropicMessage `json:"messages"`
+	Stream   bool               `json:"stream,omitempty"`
+}
+
+// AnthropicMessage is a message whose content is either a string or an array
+// of content blocks.
+type AnthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// AnthropicContentBlock is one element of an Anthropic content array. Only
+// text blocks are supported.
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Anthropic Messages Response Structure
+type AnthropicMessagesResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
+	Model        string                  `json:"model"`
+	Content      []AnthropicContentBlock `json:"content"`
+	StopReason   string                  `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        AnthropicUsage          `json:"usage"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicErrorResponse struct {
+	Type  string         `json:"type"`
+	Error AnthropicError `json:"error"`
+}
+
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// writeAnthropicError writes an Anthropic-style JSON error response.
+func writeAnthropicError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AnthropicErrorResponse{
+		Type:  "error",
+		Error: AnthropicError{Type: anthropicErrorType(status), Message: message},
+	})
+}
+
+// anthropicErrorType returns the Anthropic error type matching status.
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	if status < 500 {
+		return "invalid_request_error"
+	}
+	return "api_error"
+}
+
+// anthropicText returns the text of Anthropic content, given either as a string
+// or as an array of text blocks.
+func anthropicText(content json.RawMessage) (string, error) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return "", nil
+	}
+	if trimmed[0] != '[' {
+		var text string
+		err := json.Unmarshal(trimmed, &text)
+		return text, err
+	}
+	var blocks []AnthropicContentBlock
+	if err := json.Unmarshal(trimmed, &blocks); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, block := range blocks {
+		if block.Type != contentPartText {
+			return "", fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+		text.WriteString(block.Text)
+	}
+	return text.String(), nil
+}
+
+// toChatRequest translates an Anthropic Messages request into a chat
+// completion request, the system prompt becoming the first message.
+func (req AnthropicMessagesRequest) toChatRequest() (OpenAIChatRequest, error) {
+	chatReq := OpenAIChatRequest{Model: req.Model}
+	if req.MaxTokens > 0 {
+		chatReq.MaxTokens = &req.MaxTokens
+	}
+	system, err := anthropicText(req.System)
+	if err != nil {
+		return OpenAIChatRequest{}, fmt.Errorf("system: %w", err)
+	}
+	if system != "" {
+		chatReq.Messages = append(chatReq.Messages, MessageItem{Role: "system", Content: system})
+	}
+	for i, m := range req.Messages {
+		text, err := anthropicText(m.Content)
+		if err != nil {
+			return OpenAIChatRequest{}, fmt.Errorf("messages[%d].content: %w", i, err)
+		}
+		chatReq.Messages = append(chatReq.Messages, MessageItem{Role: m.Role, Content: text})
+	}
+	return chatReq, nil
+}
+
+// anthropicStopReason maps an OpenAI finish_reason to an Anthropic stop_reason.
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls":
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// fromChatResponse translates a chat completion into an Anthropic Messages
+// response.
+func fromChatResponse(resp OpenAIChatResponse) AnthropicMessagesResponse {
+	msg := AnthropicMessagesResponse{
+		ID:         "msg_" + strings.TrimPrefix(resp.ID, "chatcmpl-"),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      resp.Model,
+		Content:    []AnthropicContentBlock{},
+		StopReason: "end_turn",
+		Usage:      AnthropicUsage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+	}
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		msg.Content = append(msg.Content, AnthropicContentBlock{Type: contentPartText, Text: choice.Message.Content})
+		msg.StopReason = anthropicStopReason(choice.FinishReason)
+	}
+	return msg
+}
+
+// bufferedResponse captures a response in memory so that it can be translated
+// before it is sent to the client.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// handleAnthropicMessages serves the Anthropic Messages API on top of
+// handleChatCompletions: the request is translated into a chat completion,
+// which goes through the regular checks, transforms and upstream handling, and
+// the result is translated back into the Anthropic response or error shape.
+// Streaming is not supported.
+func (h *handler) handleAnthropicMessages(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isClientAbort(r, err) {
+			log.Info("Client disconnected while sending the request body", "error", err.Error())
+			return
+		}
+		log.Error(err, "Failed to read Anthropic request body")
+		rec := &bufferedResponse{header: http.Header{}}
+		writeBodyReadError(rec, err)
+		writeAnthropicError(w, rec.status, chatErrorMessage(rec.body.Bytes()))
+		return
+	}
+	defer r.Body.Close()
+
+	var req AnthropicMessagesRequest
+	if err := decodeJSONBody(body, &req); err != nil {
+		log.Info("Rejected Anthropic request with invalid JSON", "error", err.Error())
+		writeAnthropicError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
+	if req.Stream {
+		writeAnthropicError(w, http.StatusBadRequest, "stream is not supported on "+anthropicMessagesPath)
+		return
+	}
+	chatReq, err := req.toChatRequest()
+	if err != nil {
+		log.Info("Rejected Anthropic request with invalid content", "error", err.Error())
+		writeAnthropicError(w, http.StatusBadRequest, "Invalid message content: "+err.Error())
+		return
+	}
+	chatBody, err := json.Marshal(chatReq)
+	if err != nil {
+		log.Error(err, "Failed to marshal translated chat request")
+		writeAnthropicError(w, http.StatusInternalServerError, "Failed to translate request")
+		return
+	}
+
+	chatR := r.Clone(r.Context())
+	chatR.URL.Path = "/v1/chat/completions"
+	chatR.Body = io.NopCloser(bytes.NewReader(chatBody))
+	chatR.ContentLength = int64(len(chatBody))
+	chatR.Header.Del("Accept")
+	if key := r.Header.Get("X-Api-Key"); key != "" && r.Header.Get("Authorization") == "" {
+		chatR.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := &bufferedResponse{header: http.Header{}}
+	h.handleChatCompletions(rec, chatR)
+
+	for name, values := range rec.header {
+		if name == "Content-Type" || name == "Content-Length" {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	if rec.status != http.StatusOK {
+		writeAnthropicError(w, rec.status, chatErrorMessage(rec.body.Bytes()))
+		return
+	}
+	var chatResp OpenAIChatResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &chatResp); err != nil {
+		log.Error(err, "Failed to decode chat completion for translation")
+		writeAnthropicError(w, http.StatusBadGateway, "Failed to translate response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(fromChatResponse(chatResp)); err != nil {
+		log.Error(err, "Failed to encode/write Anthropic response")
+	}
+}
+
+// chatErrorMessage extracts the message of a chat completion error body, which
+// is either an OpenAI-style error or plain text.
+func chatErrorMessage(body []byte) string {
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
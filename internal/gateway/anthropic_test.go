@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestHandleAnthropicMessages(t *testing.T) {
+	var upstreamReq OpenAIChatRequest
+	var upstreamAuth, upstreamPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		upstreamAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{
+			Message: MessageItem{Role: "assistant", Content: "Hi there"},
+			Usage:   &TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+		})
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, EnableAnthropic: true})
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(body))
+		req.Header.Set("X-Api-Key", "sk-anthropic")
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleRoot(w, req)
+		return w
+	}
+
+	w := send(`{"model": "test-model", "max_tokens": 256, "system": "Be brief.", "messages": [{"role": "user", "content": [{"type": "text", "text": "Hello"}]}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if upstreamPath != "/chat" {
+		t.Errorf("Expected the request to be sent to the chat endpoint, got %s", upstreamPath)
+	}
+	if upstreamAuth != "Bearer sk-anthropic" {
+		t.Errorf("Expected x-api-key to be forwarded as a bearer token, got %q", upstreamAuth)
+	}
+	if upstreamReq.Model != "test-model" || upstreamReq.MaxTokens == nil || *upstreamReq.MaxTokens != 256 {
+		t.Errorf("Expected model and max_tokens to be translated, got %+v", upstreamReq)
+	}
+	if len(upstreamReq.Messages) != 2 || upstreamReq.Messages[0].Role != "system" || upstreamReq.Messages[0].Content != "Be brief." ||
+		upstreamReq.Messages[1].Role != "user" || upstreamReq.Messages[1].Content != "Hello" {
+		t.Errorf("Expected the system prompt and user message to be translated, got %+v", upstreamReq.Messages)
+	}
+
+	var resp AnthropicMessagesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Type != "message" || resp.Role != "assistant" || resp.Model != "test-model" || resp.StopReason != "end_turn" {
+		t.Errorf("Expected an Anthropic message response, got %+v", resp)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Type != "text" || resp.Content[0].Text != "Hi there" {
+		t.Errorf("Expected a single text block, got %+v", resp.Content)
+	}
+	if resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 3 {
+		t.Errorf("Expected usage to be translated, got %+v", resp.Usage)
+	}
+
+	for _, body := range []string{
+		`{"model": "test-model", "max_tokens": 16, "stream": true, "messages": [{"role": "user", "content": "Hello"}]}`,
+		`{"model": "test-model", "max_tokens": 16, "messages": [{"role": "user", "content": [{"type": "image", "text": ""}]}]}`,
+	} {
+		w = send(body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+		var errResp AnthropicErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+		if errResp.Type != "error" || errResp.Error.Type != "invalid_request_error" || errResp.Error.Message == "" {
+			t.Errorf("Expected an Anthropic invalid_request_error, got %+v", errResp)
+		}
+	}
+}
+
+func TestHandleAnthropicMessagesDisabled(t *testing.T) {
+	var upstreamPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL})
+	req := httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(`{"model": "test-model", "messages": []}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	h.handleRoot(httptest.NewRecorder(), req)
+	if upstreamPath != "/messages" {
+		t.Errorf("Expected /v1/messages to be forwarded when disabled, got upstream path %q", upstreamPath)
+	}
+}
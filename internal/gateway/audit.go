@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// auditRecord is one line of the audit log. It describes a chat completion
+// without any message content.
+type auditRecord struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id"`
+	Model        string    `json:"model,omitempty"`
+	MessageCount int       `json:"message_count"`
+	Stream       bool      `json:"stream"`
+	// Status is the response status, statusClientClosedRequest when the client
+	// went away before a response was written, or 0 if none was written.
+	Status     int   `json:"status"`
+	DurationMs int64 `json:"duration_ms"`
+	// Usage is the usage of the completion; for a stream, of the part relayed.
+	Usage *TokenUsage `json:"usage,omitempty"`
+	// MetadataKeys summarizes the request metadata without its values.
+	MetadataKeys []string `json:"metadata_keys,omitempty"`
+}
+
+// statusClientClosedRequest is the nginx status audited for requests whose
+// client disconnected before a response was written.
+const statusClientClosedRequest = 499
+
+// maxAuditMetadataKeys bounds the metadata keys kept in an audit record.
+const maxAuditMetadataKeys = 16
+
+// metadataKeys returns the sorted keys of the metadata object, at most
+// maxAuditMetadataKeys of them, or nil if metadata is not a JSON object. Values
+// are left out since they may carry user data.
+func metadataKeys(metadata json.RawMessage) []string {
+	var m map[string]json.RawMessage
+	if len(metadata) == 0 || json.Unmarshal(metadata, &m) != nil || len(m) == 0 {
+		return nil
+	}
+	keys := slices.Sorted(maps.Keys(m))
+	if len(keys) > maxAuditMetadataKeys {
+		keys = keys[:maxAuditMetadataKeys]
+	}
+	return keys
+}
+
+// track wraps w so that the response status is recorded in r.
+func (r *auditRecord) track(w http.ResponseWriter) http.ResponseWriter {
+	return &hookWriter{ResponseWriter: w, onWriteHeader: func(_ http.Header, status int) int {
+		r.Status = status
+		return status
+	}}
+}
+
+// auditLog appends audit records as JSON lines to a file.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openAuditLog opens path for appending, creating it if needed.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &auditLog{file: f}, nil
+}
+
+// write completes rec with the time elapsed since start and appends it. Write
+// failures are logged but never affect the response.
+func (a *auditLog) write(log logr.Logger, rec *auditRecord, start time.Time) {
+	rec.Time = start.UTC()
+	rec.DurationMs = time.Since(start).Milliseconds()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Error(err, "Failed to encode audit record")
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Error(err, "Failed to write audit record")
+	}
+}
+
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
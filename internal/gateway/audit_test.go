@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestAuditLogChatCompletions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Secret answer"}, "prompt_eval_count": 3, "eval_count": 4}`))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer audit.Close()
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, AllowedModels: []string{"test-model"}}, audit: audit}
+
+	bodies := []string{
+		`{"model": "test-model", "messages": [{"role": "system", "content": "Be brief"}, {"role": "user", "content": "Secret question"}]}`,
+		`{"model": "other-model", "messages": [{"role": "user", "content": "Secret question"}]}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		h.handleChatCompletions(httptest.NewRecorder(), req)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	if strings.Contains(string(data), "Secret") {
+		t.Errorf("Expected no message content in the audit log, got %s", data)
+	}
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Expected a well-formed JSON line, got %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected one audit line per request, got %d", len(records))
+	}
+
+	ok := records[0]
+	if ok.RequestID == "" || ok.Model != "test-model" || ok.MessageCount != 2 || ok.Status != http.StatusOK || ok.Time.IsZero() {
+		t.Errorf("Unexpected audit record for a successful request: %+v", ok)
+	}
+	if ok.Usage == nil || ok.Usage.PromptTokens != 3 || ok.Usage.CompletionTokens != 4 || ok.Usage.TotalTokens != 7 {
+		t.Errorf("Expected token usage in the audit record, got %+v", ok.Usage)
+	}
+
+	rejected := records[1]
+	if rejected.Model != "other-model" || rejected.Status != http.StatusForbidden || rejected.Usage != nil {
+		t.Errorf("Unexpected audit record for a rejected request: %+v", rejected)
+	}
+}
+
+func TestAuditLogMetadata(t *testing.T) {
+	var forwarded map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		forwarded, _ = payload["metadata"].(map[string]any)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer audit.Close()
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}, audit: audit}
+
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "metadata": {"team": "secret-team", "env": "prod"}}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	h.handleChatCompletions(httptest.NewRecorder(), req)
+
+	if forwarded["team"] != "secret-team" || forwarded["env"] != "prod" {
+		t.Errorf("Expected metadata to be forwarded unchanged, got %v", forwarded)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	if strings.Contains(string(data), "secret-team") {
+		t.Errorf("Expected no metadata values in the audit log, got %s", data)
+	}
+	var rec auditRecord
+	if err := json.Unmarshal(bytes.TrimSpace(data), &rec); err != nil {
+		t.Fatalf("Failed to decode audit record %q: %v", data, err)
+	}
+	if strings.Join(rec.MetadataKeys, ",") != "env,team" {
+		t.Errorf("Expected the sorted metadata keys in the audit record, got %v", rec.MetadataKeys)
+	}
+}
+
+// readAuditRecord returns the single record of the audit file at path.
+func readAuditRecord(t *testing.T, path string) auditRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	var rec auditRecord
+	if err := json.Unmarshal(bytes.TrimSpace(data), &rec); err != nil {
+		t.Fatalf("Failed to decode audit record %q: %v", data, err)
+	}
+	return rec
+}
+
+func TestAuditLogStreamUsage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hel"}}` + "\n"))
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "lo"}}` + "\n"))
+		w.Write([]byte(`{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 5, "eval_count": 2}` + "\n"))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer audit.Close()
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}, audit: audit}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "stream": true, "messages": [{"role": "user", "content": "Hello"}]}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	h.handleChatCompletions(httptest.NewRecorder(), req)
+
+	rec := readAuditRecord(t, path)
+	if !rec.Stream || rec.Status != http.StatusOK {
+		t.Errorf("Unexpected audit record for a stream: %+v", rec)
+	}
+	if rec.Usage == nil || rec.Usage.PromptTokens != 5 || rec.Usage.CompletionTokens != 2 || rec.Usage.TotalTokens != 7 {
+		t.Errorf("Expected the stream usage in the audit record, got %+v", rec.Usage)
+	}
+}
+
+func TestAuditLogClientAbort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer audit.Close()
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}, audit: audit}
+
+	body := io.MultiReader(strings.NewReader(`{"model": "test-model"`), iotest.ErrReader(io.ErrUnexpectedEOF))
+	req := httptest.NewRequest("POST", "/v1/chat/completions", body)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	h.handleChatCompletions(httptest.NewRecorder(), req)
+
+	if rec := readAuditRecord(t, path); rec.Status != statusClientClosedRequest || rec.Usage != nil {
+		t.Errorf("Expected a client abort to be audited with status %d, got %+v", statusClientClosedRequest, rec)
+	}
+}
+
+func TestOpenAuditLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o600); err != nil {
+		t.Fatalf("Failed to seed audit file: %v", err)
+	}
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	audit.write(logr.Discard(), &auditRecord{RequestID: "req"}, time.Now())
+	audit.Close()
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[0] != "{}" {
+		t.Errorf("Expected the record to be appended to existing content, got %q", data)
+	}
+}
@@ -0,0 +1,194 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultBenchPrompt is the user message of every benchmark chat completion.
+	defaultBenchPrompt = "Reply with OK."
+	// defaultBenchConcurrency is the default number of concurrent benchmark clients.
+	defaultBenchConcurrency = 4
+	// defaultBenchRequests is the default number of benchmark chat completions.
+	defaultBenchRequests = 100
+)
+
+// benchOptions configure a benchmark run. The run ends once Requests chat
+// completions were sent or Duration has elapsed, whichever comes first; a zero
+// value disables that bound.
+type benchOptions struct {
+	Model       string
+	Prompt      string
+	Concurrency int
+	Requests    int
+	Duration    time.Duration
+}
+
+// benchResult summarizes a benchmark run.
+type benchResult struct {
+	Requests  int
+	Errors    int
+	Elapsed   time.Duration
+	latencies []time.Duration
+}
+
+// throughput returns the successful requests per second.
+func (r benchResult) throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests-r.Errors) / r.Elapsed.Seconds()
+}
+
+// NewBenchCommand creates a cobra command that fires concurrent chat
+// completions at an upstream through the gateway and reports throughput and
+// latency percentiles, for capacity planning.
+func NewBenchCommand() *cobra.Command {
+	var openWebUIURL string
+	var openWebUIAPIKey string
+	var opts benchOptions
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Benchmarks chat completions against an upstream through the gateway",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := &Config{
+				OpenWebUIURL:           openWebUIURL,
+				OpenWebUIAPIKey:        openWebUIAPIKey,
+				DialTimeoutSec:         defaultDialTimeoutSec,
+				RetryBackoffMs:         defaultRetryBackoffMs,
+				UpstreamResponseFormat: upstreamFormatAuto,
+			}
+			result, err := runBench(cmd.Context(), cfg, opts)
+			if err != nil {
+				return err
+			}
+			writeBenchResult(cmd.OutOrStdout(), result)
+			if result.Requests > 0 && result.Errors == result.Requests {
+				return fmt.Errorf("bench failed: all %d requests failed", result.Requests)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&openWebUIURL, "open-webui-url", os.Getenv("OPEN_WEBUI_URL"), "Open-WebUI API endpoint URL to benchmark (can also be set via OPEN_WEBUI_URL env var)")
+	cmd.Flags().StringVar(&openWebUIAPIKey, "open-webui-api-key", os.Getenv("OPEN_WEBUI_API_KEY"), "API key sent to Open-WebUI (can also be set via OPEN_WEBUI_API_KEY env var)")
+	cmd.Flags().StringVar(&opts.Model, "model", defaultSelftestModel, "Model used for the benchmark chat completions")
+	cmd.Flags().StringVar(&opts.Prompt, "prompt", defaultBenchPrompt, "User message sent in every benchmark chat completion")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", defaultBenchConcurrency, "Number of concurrent clients")
+	cmd.Flags().IntVar(&opts.Requests, "requests", defaultBenchRequests, "Total number of chat completions to send (0 means no limit, requires --duration)")
+	cmd.Flags().DurationVar(&opts.Duration, "duration", 0, "Stop starting new requests after this long, e.g. 30s (0 means no limit)")
+
+	return cmd
+}
+
+// runBench serves the gateway on a loopback listener, see serveLoopback, and
+// sends chat completions through it from opts.Concurrency clients. Requests in
+// flight when opts.Duration elapses are completed, not canceled.
+func runBench(ctx context.Context, cfg *Config, opts benchOptions) (benchResult, error) {
+	if cfg.OpenWebUIURL == "" {
+		return benchResult{}, fmt.Errorf("--open-webui-url is required")
+	}
+	if err := validateOpenWebUIURL(cfg.OpenWebUIURL); err != nil {
+		return benchResult{}, err
+	}
+	if opts.Concurrency < 1 {
+		return benchResult{}, fmt.Errorf("--concurrency must be at least 1")
+	}
+	if opts.Requests <= 0 && opts.Duration <= 0 {
+		return benchResult{}, fmt.Errorf("either --requests or --duration must be set")
+	}
+	reqBody, err := json.Marshal(OpenAIChatRequest{
+		Model:    opts.Model,
+		Messages: []MessageItem{{Role: "user", Content: opts.Prompt}},
+	})
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	baseURL, stop, err := serveLoopback(ctx, cfg)
+	if err != nil {
+		return benchResult{}, err
+	}
+	defer stop()
+
+	client := &http.Client{
+		Timeout:   selftestTimeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.Concurrency},
+	}
+	var (
+		issued   atomic.Int64
+		mu       sync.Mutex
+		result   benchResult
+		wg       sync.WaitGroup
+		start    = time.Now()
+		deadline time.Time
+	)
+	if opts.Duration > 0 {
+		deadline = start.Add(opts.Duration)
+	}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if opts.Requests > 0 && issued.Add(1) > int64(opts.Requests) {
+					return
+				}
+				if !deadline.IsZero() && !time.Now().Before(deadline) {
+					return
+				}
+				reqStart := time.Now()
+				err := benchChatCompletion(ctx, client, baseURL, reqBody)
+				latency := time.Since(reqStart)
+
+				mu.Lock()
+				result.Requests++
+				if err != nil {
+					result.Errors++
+				} else {
+					result.latencies = append(result.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	return result, nil
+}
+
+// benchChatCompletion sends one chat completion and checks that it succeeded.
+func benchChatCompletion(ctx context.Context, client *http.Client, baseURL string, reqBody []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/v1/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var chatResp OpenAIChatResponse
+	return selftestDo(client, req, &chatResp)
+}
+
+// writeBenchResult reports the throughput and latency percentiles of a run.
+func writeBenchResult(out io.Writer, r benchResult) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	fmt.Fprintf(out, "requests:   %d (%d failed)\n", r.Requests, r.Errors)
+	fmt.Fprintf(out, "elapsed:    %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "throughput: %.2f req/s\n", r.throughput())
+	fmt.Fprintf(out, "latency:    p50 %.1fms, p95 %.1fms, p99 %.1fms\n",
+		ms(percentile(r.latencies, 50)), ms(percentile(r.latencies, 95)), ms(percentile(r.latencies, 99)))
+}
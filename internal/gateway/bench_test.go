@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestBenchCommand(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chatReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&chatReq)
+		if len(chatReq.Messages) != 1 || chatReq.Messages[0].Content != "Benchmark me" {
+			t.Errorf("Expected the fixed prompt upstream, got %+v", chatReq.Messages)
+		}
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "OK"}})
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	cmd := NewBenchCommand()
+	cmd.SetContext(logr.NewContext(context.Background(), logr.Discard()))
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--open-webui-url", upstream.URL, "--prompt", "Benchmark me", "--concurrency", "3", "--requests", "20"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected bench to succeed, got %v\n%s", err, out.String())
+	}
+	if n := calls.Load(); n != 20 {
+		t.Errorf("Expected 20 upstream chat completions, got %d", n)
+	}
+	for _, want := range []string{"requests:   20 (0 failed)", "throughput:", "p95"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "throughput: 0.00") {
+		t.Errorf("Expected non-zero throughput, got:\n%s", out.String())
+	}
+}
+
+func TestRunBenchDuration(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "OK"}})
+	}))
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	result, err := runBench(ctx, &Config{OpenWebUIURL: upstream.URL}, benchOptions{Model: "bench", Prompt: "Hi", Concurrency: 2, Duration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Requests == 0 || result.Errors != 0 || result.throughput() <= 0 {
+		t.Errorf("Expected successful requests and non-zero throughput, got %+v", result)
+	}
+
+	if _, err := runBench(ctx, &Config{OpenWebUIURL: upstream.URL}, benchOptions{Concurrency: 1}); err == nil {
+		t.Errorf("Expected an error without --requests or --duration")
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// limitBody is a middleware that caps the size of the request body at
+// Config.MaxBodyBytes. http.MaxBytesReader enforces the cap on the bytes actually
+// read, so chunked bodies without a Content-Length are bounded as well. When
+// metrics are enabled, body sizes and rejections are recorded as the body is read.
+func (h *handler) limitBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Config.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, h.Config.MaxBodyBytes)
+		}
+		if h.metrics != nil && r.Body != nil {
+			r.Body = &meteredBody{ReadCloser: r.Body, metrics: h.metrics}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// meteredBody counts the bytes read from a request body and reports them to
+// metrics once the body is exhausted or rejected for its size.
+type meteredBody struct {
+	io.ReadCloser
+	metrics *metrics
+	n       int64
+	done    bool
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && !b.done {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			b.done = true
+			b.metrics.observeBody(b.n, true)
+		case err == io.EOF:
+			b.done = true
+			b.metrics.observeBody(b.n, false)
+		}
+	}
+	return n, err
+}
+
+// writeBodyReadError responds to a failure reading the request body, using
+// 413 when the body exceeded the configured limit.
+func writeBodyReadError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Failed to read request body", http.StatusBadRequest)
+}
+
+// isClientAbort reports whether reading the body of r failed with err because
+// the client went away, in which case there is nobody left to answer.
+func isClientAbort(r *http.Request, err error) bool {
+	return r.Context().Err() != nil || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// errJSONTooDeep reports a JSON document nested deeper than allowed.
+var errJSONTooDeep = errors.New("JSON nesting too deep")
+
+// checkJSONDepth scans body token by token and fails as soon as objects and
+// arrays nest deeper than maxDepth, before a full decode allocates for them.
+// Syntax errors are left for the decoder that follows to report.
+func checkJSONDepth(body []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("%w: exceeds the limit of %d", errJSONTooDeep, maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// errTrailingData reports content after the JSON value of a request body.
+var errTrailingData = errors.New("unexpected data after the JSON body")
+
+// decodeJSONBody decodes the single JSON value of body into v. Anything but
+// whitespace after the value usually signals a client bug, such as two
+// concatenated requests, and is rejected with errTrailingData.
+func decodeJSONBody(body []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body[dec.InputOffset():])) > 0 {
+		return errTrailingData
+	}
+	return nil
+}
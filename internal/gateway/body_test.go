@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func newBodyLimitServer(t *testing.T, maxBodyBytes int64) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, MaxBodyBytes: maxBodyBytes}}
+	ts := httptest.NewServer(wrapLogger(logr.Discard(), h.limitBody(h.handleRoot)))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestLimitBodyWithinLimit(t *testing.T) {
+	ts := newBodyLimitServer(t, 1024)
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestLimitBodyExceeded(t *testing.T) {
+	ts := newBodyLimitServer(t, 64)
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "` + strings.Repeat("a", 256) + `"}]}`
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+func TestLimitBodyChunkedExceeded(t *testing.T) {
+	ts := newBodyLimitServer(t, 64)
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "` + strings.Repeat("a", 256) + `"}]}`
+
+	// Wrapping the reader hides its length, so the client falls back to
+	// chunked transfer encoding without a Content-Length header.
+	req, err := http.NewRequestWithContext(logr.NewContext(context.Background(), logr.Discard()), "POST", ts.URL+"/v1/chat/completions", io.MultiReader(bytes.NewReader([]byte(body))))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if req.ContentLength != 0 {
+		t.Fatalf("Expected unknown content length, got %d", req.ContentLength)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
+
+func TestHandleChatCompletionsMaxJSONDepth(t *testing.T) {
+	var upstreamCalled bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, MaxJSONDepth: 16}}
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	nested := strings.Repeat("[", 100000) + strings.Repeat("]", 100000)
+	w := send(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "logit_bias": ` + nested + `}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "nesting too deep") {
+		t.Errorf("Expected a nesting depth error, got %q", w.Body.String())
+	}
+	if upstreamCalled {
+		t.Errorf("Expected a deeply nested body not to be forwarded")
+	}
+
+	w = send(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "logit_bias": {"50256": -100}}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a shallow body to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCheckJSONDepth(t *testing.T) {
+	tests := []struct {
+		body    string
+		max     int
+		wantErr bool
+	}{
+		{`{"a": [1, 2]}`, 2, false},
+		{`{"a": [[1]]}`, 2, true},
+		{`[{}, {}, {}]`, 2, false},
+		{`{"a": "[[[[not nesting]]]]"}`, 1, false},
+		{`{"a": [`, 1, true},
+		{`not json`, 1, false},
+	}
+	for _, tt := range tests {
+		if err := checkJSONDepth([]byte(tt.body), tt.max); (err != nil) != tt.wantErr {
+			t.Errorf("checkJSONDepth(%q, %d) = %v, want error %v", tt.body, tt.max, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleChatCompletionsTrailingData(t *testing.T) {
+	var upstreamCalled bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL}}
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	valid := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+	w := send(valid + valid)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "unexpected data after the JSON body") {
+		t.Errorf("Expected a trailing data error, got %q", w.Body.String())
+	}
+	if upstreamCalled {
+		t.Errorf("Expected a body with trailing data not to be forwarded")
+	}
+
+	w = send(valid + "\r\n \n")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected trailing whitespace to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	tests := []struct {
+		body     string
+		wantErr  bool
+		trailing bool
+	}{
+		{`{"a": 1}`, false, false},
+		{"{\"a\": 1}\n\t ", false, false},
+		{`{"a": 1}}`, true, true},
+		{`{"a": 1} {"a": 2}`, true, true},
+		{`{"a": 1`, true, false},
+		{``, true, false},
+	}
+	for _, tt := range tests {
+		var v map[string]any
+		err := decodeJSONBody([]byte(tt.body), &v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeJSONBody(%q) = %v, want error %v", tt.body, err, tt.wantErr)
+		}
+		if errors.Is(err, errTrailingData) != tt.trailing {
+			t.Errorf("decodeJSONBody(%q) = %v, want trailing data error %v", tt.body, err, tt.trailing)
+		}
+	}
+}
+
+func TestForwardClientAbortDuringBodyRead(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	wrote := make(chan bool, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		written := false
+		hw := &hookWriter{ResponseWriter: w, onWriteHeader: func(_ http.Header, status int) int {
+			written = true
+			return status
+		}}
+		h.forwardAndTransform(hw, r.WithContext(logr.NewContext(r.Context(), logr.Discard())))
+		wrote <- written
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	fmt.Fprintf(conn, "POST /v1/embeddings HTTP/1.1\r\nHost: gateway\r\nContent-Length: 100\r\n\r\n{\"input\":")
+	conn.Close()
+
+	select {
+	case written := <-wrote:
+		if written {
+			t.Errorf("Expected no response to be written to a client that aborted the body")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the handler to return")
+	}
+}
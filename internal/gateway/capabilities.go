@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// capabilitiesPath is the route describing the features of the gateway.
+const capabilitiesPath = "/v1/capabilities"
+
+// capabilities describes which OpenAI features the gateway supports with its
+// current configuration, so clients can feature-detect.
+type capabilities struct {
+	Object string `json:"object"`
+	// Endpoints are the OpenAI routes served or forwarded by the gateway.
+	Endpoints []string `json:"endpoints"`
+	Streaming bool     `json:"streaming"`
+	// MaxStreams and MaxStreamDurationSec are the streaming limits; 0 means
+	// unlimited.
+	MaxStreams           int `json:"max_streams,omitempty"`
+	MaxStreamDurationSec int `json:"max_stream_duration_sec,omitempty"`
+	// Tools reports whether tool definitions reach the model.
+	Tools bool `json:"tools"`
+	// ImageInputs reports support for image_url content parts.
+	ImageInputs bool `json:"image_inputs"`
+	Logprobs    bool `json:"logprobs"`
+	// MaxChoices is the largest n accepted on a chat completion.
+	MaxChoices   int  `json:"max_choices"`
+	DefaultModel bool `json:"default_model"`
+	// AllowedModels restricts chat models; empty means all upstream models.
+	AllowedModels  []string `json:"allowed_models,omitempty"`
+	MaxPromptChars int      `json:"max_prompt_chars,omitempty"`
+	MaxBodyBytes   int64    `json:"max_body_bytes,omitempty"`
+	ModelsCache    bool     `json:"models_cache"`
+	Metrics        bool     `json:"metrics"`
+}
+
+// capabilities returns the feature set of the handler's configuration.
+// Streaming, tools, image inputs and logprobs are always supported.
+func (h *handler) capabilities() capabilities {
+	return capabilities{
+		Object:               "gateway.capabilities",
+		Endpoints:            h.routes(),
+		Streaming:            true,
+		Tools:                true,
+		MaxStreams:           h.Config.MaxStreamingConnections,
+		MaxStreamDurationSec: h.Config.MaxStreamDurationSec,
+		ImageInputs:          true,
+		Logprobs:             true,
+		MaxChoices:           maxChoices,
+		DefaultModel:         h.Config.DefaultModel != "",
+		AllowedModels:        h.Config.AllowedModels,
+		MaxPromptChars:       h.Config.MaxPromptChars,
+		MaxBodyBytes:         h.Config.MaxBodyBytes,
+		ModelsCache:          h.models != nil,
+		Metrics:              h.metrics != nil,
+	}
+}
+
+// routes returns the sorted OpenAI routes of the gateway: the ones it serves
+// itself and the jsonEndpoints it forwards to Open-WebUI.
+func (h *handler) routes() []string {
+	endpoints := []string{capabilitiesPath, "/v1/chat/completions"}
+	for path := range jsonEndpoints {
+		endpoints = append(endpoints, "/v1"+path)
+	}
+	if h.Config.EnableAnthropic {
+		endpoints = append(endpoints, anthropicMessagesPath)
+	}
+	slices.Sort(endpoints)
+	return endpoints
+}
+
+// handleCapabilities serves the capabilities of the gateway.
+func (h *handler) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.capabilities()); err != nil {
+		log.Error(err, "Failed to encode capabilities")
+	}
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestHandleCapabilities(t *testing.T) {
+	get := func(h *handler) capabilities {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/v1/capabilities", nil)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleRoot(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected Content-Type application/json, got %s", ct)
+		}
+		var caps capabilities
+		if err := json.NewDecoder(w.Body).Decode(&caps); err != nil {
+			t.Fatalf("Failed to decode capabilities: %v", err)
+		}
+		return caps
+	}
+
+	caps := get(newHandler(&Config{OpenWebUIURL: "http://dummy-url"}))
+	if !caps.Streaming || !caps.Tools {
+		t.Errorf("Expected streaming and tools to be reported, got %+v", caps)
+	}
+	want := []string{"/v1/capabilities", "/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/models", "/v1/moderations"}
+	if !slices.Equal(caps.Endpoints, want) {
+		t.Errorf("Expected endpoints %v, got %v", want, caps.Endpoints)
+	}
+	if caps.Metrics || caps.ModelsCache || caps.DefaultModel || caps.AllowedModels != nil || caps.MaxPromptChars != 0 ||
+		caps.MaxBodyBytes != 0 || caps.MaxStreams != 0 || caps.MaxStreamDurationSec != 0 {
+		t.Errorf("Expected optional features to be off by default, got %+v", caps)
+	}
+
+	caps = get(newHandler(&Config{
+		OpenWebUIURL:            "http://dummy-url",
+		Metrics:                 true,
+		ModelsCacheTTLSec:       60,
+		DefaultModel:            "test-model",
+		AllowedModels:           []string{"test-model"},
+		MaxPromptChars:          1000,
+		MaxBodyBytes:            4096,
+		EnableAnthropic:         true,
+		MaxStreamingConnections: 8,
+		MaxStreamDurationSec:    300,
+	}))
+	if !caps.Metrics || !caps.ModelsCache || !caps.DefaultModel || caps.MaxPromptChars != 1000 || caps.MaxBodyBytes != 4096 {
+		t.Errorf("Expected configured features to be reported, got %+v", caps)
+	}
+	if caps.MaxStreams != 8 || caps.MaxStreamDurationSec != 300 {
+		t.Errorf("Expected streaming limits to be reported, got %+v", caps)
+	}
+	if !slices.Contains(caps.Endpoints, "/v1/messages") {
+		t.Errorf("Expected /v1/messages with EnableAnthropic, got %v", caps.Endpoints)
+	}
+	if !slices.Equal(caps.AllowedModels, []string{"test-model"}) {
+		t.Errorf("Expected allowed models to be reported, got %v", caps.AllowedModels)
+	}
+}
+
+func TestHandleCapabilitiesMethodNotAllowed(t *testing.T) {
+	h := &handler{Config: &Config{}}
+	req := httptest.NewRequest("POST", "/v1/capabilities", nil)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.handleRoot(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// maxChoices is the largest n accepted on a chat completion request.
+const maxChoices = 128
+
+// fetchChatChoices generates n choices for a buffered chat completion. Open-WebUI
+// answers with a single message, so n upstream calls are made, at most
+// Config.NConcurrency at a time. The request holds a single upstream slot, see
+// withConcurrencyLimit, so every further concurrent call takes a free slot of
+// its own; without one the calls run one after the other. The first failure
+// cancels the remaining calls and is returned.
+func (h *handler) fetchChatChoices(ctx context.Context, newReq upstreamRequestFunc, n int) ([]OpenWebUIChatResponse, error) {
+	if n == 1 {
+		resp, err := h.fetchChatCompletion(ctx, newReq)
+		if err != nil {
+			return nil, err
+		}
+		return []OpenWebUIChatResponse{resp}, nil
+	}
+
+	limit := h.Config.NConcurrency
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resps := make([]OpenWebUIChatResponse, n)
+	var next, completed atomic.Int32
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	fetch := func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			i := int(next.Add(1)) - 1
+			if i >= n {
+				return
+			}
+			resp, err := h.fetchChatCompletion(ctx, newReq)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			resps[i] = resp
+			completed.Add(1)
+		}
+	}
+	wg.Add(1)
+	go fetch()
+	for range limit - 1 {
+		if h.scheduler != nil && !h.scheduler.tryAcquire() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			if h.scheduler != nil {
+				defer h.scheduler.release(priorityNormal)
+			}
+			fetch()
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if int(completed.Load()) < n {
+		return nil, ctx.Err()
+	}
+	return resps, nil
+}
+
+// add returns the sum of two token usages.
+func (u TokenUsage) add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
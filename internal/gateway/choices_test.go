@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func newChoicesRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+	return req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+}
+
+func TestHandleChatCompletionsNConcurrency(t *testing.T) {
+	var active, peak, calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq map[string]any
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		if _, ok := upstreamReq["n"]; ok {
+			t.Errorf("Expected n not to be forwarded upstream, got %v", upstreamReq["n"])
+		}
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}, "prompt_eval_count": 5, "eval_count": 2}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, NConcurrency: 2}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newChoicesRequest(t, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 4}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d, body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("Expected 4 upstream calls, got %d", n)
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("Expected at most 2 simultaneous upstream calls, got %d", p)
+	}
+
+	var chatResp OpenAIChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&chatResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(chatResp.Choices) != 4 {
+		t.Fatalf("Expected 4 choices, got %d", len(chatResp.Choices))
+	}
+	for i, choice := range chatResp.Choices {
+		if choice.Index != i || choice.Message.Content != "Hi" {
+			t.Errorf("Unexpected choice %d: %+v", i, choice)
+		}
+	}
+	if want := (TokenUsage{PromptTokens: 20, CompletionTokens: 8, TotalTokens: 28}); chatResp.Usage != want {
+		t.Errorf("Expected usage summed over all choices %+v, got %+v", want, chatResp.Usage)
+	}
+}
+
+func TestHandleChatCompletionsNMaxConcurrency(t *testing.T) {
+	var active, peak, calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer ts.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: ts.URL, MaxConcurrency: 2}
+	h := newHandler(cfg)
+	mainSrv, _ := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	w := httptest.NewRecorder()
+	mainSrv.Handler.ServeHTTP(w, newChoicesRequest(t, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 6}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d, body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 6 {
+		t.Errorf("Expected 6 upstream calls, got %d", n)
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("Expected the choices to stay within --max-concurrency 2, got %d simultaneous upstream calls", p)
+	}
+	if active := h.scheduler.active; active != 0 {
+		t.Errorf("Expected every upstream slot to be released, got %d active", active)
+	}
+}
+
+func TestHandleChatCompletionsNFailure(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, NConcurrency: 1}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newChoicesRequest(t, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 3}`))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d when a choice fails, got %d", http.StatusBadGateway, w.Code)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected the remaining calls to be skipped after a failure, got %d calls", n)
+	}
+}
+
+func TestHandleChatCompletionsInvalidN(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	bodies := []string{
+		`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 0}`,
+		`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 129}`,
+		`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "n": 2, "stream": true}`,
+	}
+	for _, body := range bodies {
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, newChoicesRequest(t, body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
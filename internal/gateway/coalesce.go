@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader identifies retries of the same request. It is forwarded
+// to Open-WebUI and, with Config.CoalesceRequests or Config.DedupWindowSec, keys
+// the coalescer.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// coalescer shares one buffered chat completion between concurrent requests
+// carrying the same key, so that a client retrying a request that is still in
+// flight receives the original response instead of triggering a second upstream
+// call. Successful results are kept for window after the first request
+// completes, so that rapid retries are answered from them as well; errors are
+// dropped right away.
+type coalescer struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	resp OpenAIChatResponse
+	err  error
+}
+
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{window: window, calls: map[string]*coalescedCall{}}
+}
+
+// do runs fn for the first request with key and hands its result to every
+// request with the same key arriving before fn returns, or within the window
+// after a successful return. shared reports whether the result was produced for
+// another request. Waiting ends early with the error of ctx once it is done.
+func (c *coalescer) do(ctx context.Context, key string, fn func() (OpenAIChatResponse, error)) (resp OpenAIChatResponse, shared bool, err error) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.resp, true, call.err
+		case <-ctx.Done():
+			return OpenAIChatResponse{}, true, ctx.Err()
+		}
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	call.resp, call.err = fn()
+	if call.err == nil && c.window > 0 {
+		time.AfterFunc(c.window, func() { c.forget(key, call) })
+	} else {
+		c.forget(key, call)
+	}
+	close(call.done)
+	return call.resp, false, call.err
+}
+
+// forget drops call unless key has been taken over by another call since.
+func (c *coalescer) forget(key string, call *coalescedCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+}
+
+// coalesceKey returns the coalescer key of a buffered chat request r to target
+// with the client request body, or "" if the request is not coalesced. Requests
+// are keyed by their idempotencyKeyHeader or, with Config.DedupWindowSec, by the
+// request itself. Either way the key is hashed with the caller credentials and
+// the routing headers, so that requests of different callers are never shared.
+func (h *handler) coalesceKey(r *http.Request, target string, body []byte) string {
+	if h.coalescer == nil {
+		return ""
+	}
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" && h.Config.DedupWindowSec <= 0 {
+		return ""
+	}
+	sum := sha256.New()
+	parts := []string{r.Header.Get("Authorization"), r.Header.Get(pipelineIDHeader), target}
+	for _, part := range append(parts, orgHeaderValues(r)...) {
+		sum.Write([]byte(part))
+		sum.Write([]byte{0})
+	}
+	if key != "" {
+		sum.Write([]byte(key))
+		return "key:" + hex.EncodeToString(sum.Sum(nil))
+	}
+	sum.Write([]byte(r.Header.Get(chatIDHeader)))
+	sum.Write([]byte{0})
+	sum.Write(body)
+	return "sha256:" + hex.EncodeToString(sum.Sum(nil))
+}
+
+// orgHeaderValues returns the values of the orgHeaders of r in a fixed order.
+func orgHeaderValues(r *http.Request) []string {
+	var values []string
+	for _, name := range orgHeaders {
+		values = append(values, name+":"+r.Header.Get(name))
+	}
+	return values
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestHandleChatCompletionsIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	var keys sync.Map
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		keys.Store(r.Header.Get(idempotencyKeyHeader), true)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, CoalesceRequests: true})
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req.Header.Set(idempotencyKeyHeader, key)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	results := make(chan *httptest.ResponseRecorder, 3)
+	for _, key := range []string{"key-1", "key-1", "key-2"} {
+		go func() { results <- send(key) }()
+	}
+	// Give all three requests time to reach the upstream or join a call.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	ids := map[string]int{}
+	for i := 0; i < 3; i++ {
+		w := <-results
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp OpenAIChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		ids[resp.ID]++
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 upstream calls for 2 distinct keys, got %d", n)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected the requests with the same key to share a response, got IDs %v", ids)
+	}
+	for _, key := range []string{"key-1", "key-2"} {
+		if _, ok := keys.Load(key); !ok {
+			t.Errorf("Expected %s %q to be forwarded upstream", idempotencyKeyHeader, key)
+		}
+	}
+
+	// Without coalescing the key is still forwarded, but every request goes upstream.
+	calls.Store(0)
+	h = newHandler(&Config{OpenWebUIURL: upstream.URL})
+	send("key-1")
+	send("key-1")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 upstream calls without coalescing, got %d", n)
+	}
+}
+
+func TestHandleChatCompletionsIdempotencyKeyScope(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, CoalesceRequests: true})
+	send := func(ctx context.Context, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		req.Header.Set("Authorization", auth)
+		req = req.WithContext(logr.NewContext(ctx, logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	// The first client disconnects while its call is shared with a retry.
+	leaderCtx, disconnect := context.WithCancel(context.Background())
+	leader := make(chan *httptest.ResponseRecorder, 1)
+	go func() { leader <- send(leaderCtx, "Bearer user-1") }()
+	time.Sleep(50 * time.Millisecond)
+	results := make(chan *httptest.ResponseRecorder, 2)
+	for _, auth := range []string{"Bearer user-1", "Bearer user-2"} {
+		go func() { results <- send(context.Background(), auth) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	disconnect()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if w := <-results; w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	}
+	<-leader
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected the same key of another caller not to be shared, got %d upstream calls", n)
+	}
+}
+
+func TestHandleChatCompletionsDedupWindow(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, DedupWindowSec: 10})
+	send := func(auth, content string) OpenAIChatResponse {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "`+content+`"}]}`))
+		req.Header.Set("Authorization", auth)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp OpenAIChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	first := send("Bearer user-1", "Hello")
+	second := send("Bearer user-1", "Hello")
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 upstream call for a duplicate within the window, got %d", n)
+	}
+	if first.ID != second.ID {
+		t.Errorf("Expected the duplicate to get the prior response, got IDs %s and %s", first.ID, second.ID)
+	}
+
+	send("Bearer user-2", "Hello")
+	send("Bearer user-1", "Hello again")
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected other callers and other requests not to be deduplicated, got %d upstream calls", n)
+	}
+}
+
+func TestCoalescerWindowExpiry(t *testing.T) {
+	c := newCoalescer(20 * time.Millisecond)
+	var calls int
+	fn := func() (OpenAIChatResponse, error) {
+		calls++
+		return OpenAIChatResponse{ID: "resp"}, nil
+	}
+	ctx := context.Background()
+	c.do(ctx, "key", fn)
+	if _, shared, _ := c.do(ctx, "key", fn); !shared || calls != 1 {
+		t.Errorf("Expected the result to be shared within the window, got shared %v after %d calls", shared, calls)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, shared, _ := c.do(ctx, "key", fn); shared || calls != 2 {
+		t.Errorf("Expected a new call after the window, got shared %v after %d calls", shared, calls)
+	}
+}
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// connErrorClass is the client-facing description of a failure to reach
+// Open-WebUI, see classifyConnError.
+type connErrorClass struct {
+	status  int
+	errType string
+	code    string
+	message string
+}
+
+// classifyConnError maps an upstream transport error to the status and
+// OpenAI-style error reported to the client, so that clients and operators can
+// tell an unresolvable host from a refused connection, a TLS problem or a
+// timeout. Unrecognized errors are reported as a generic connection error.
+func classifyConnError(err error) connErrorClass {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return connErrorClass{http.StatusGatewayTimeout, "timeout_error", "upstream_connect_timeout", "Timed out connecting to Open-WebUI"}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return connErrorClass{http.StatusBadGateway, "upstream_error", "upstream_dns_error", "Failed to resolve the Open-WebUI host"}
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return connErrorClass{http.StatusBadGateway, "upstream_error", "upstream_connection_refused", "Open-WebUI refused the connection"}
+	}
+	if isEarlyClose(err) {
+		return connErrorClass{http.StatusBadGateway, "upstream_error", "upstream_closed", "Upstream closed connection before responding"}
+	}
+	if isTLSError(err) {
+		return connErrorClass{http.StatusBadGateway, "upstream_error", "upstream_tls_error", "TLS handshake with Open-WebUI failed"}
+	}
+	return connErrorClass{http.StatusBadGateway, "upstream_error", "upstream_connection_error", "Failed to contact Open-WebUI"}
+}
+
+// isEarlyClose reports whether err means that the upstream accepted the
+// connection but closed it before sending any response headers.
+func isEarlyClose(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isTLSError reports whether err stems from the TLS handshake or from
+// certificate verification.
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// writeConnError answers a request whose upstream exchange failed with err
+// before any response was received.
+func writeConnError(w http.ResponseWriter, err error) {
+	c := classifyConnError(err)
+	writeOpenAIError(w, c.status, c.errType, c.code, c.message)
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestClassifyConnError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "webui.invalid", IsNotFound: true}}, http.StatusBadGateway, "upstream_dns_error"},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "webui.invalid", IsTimeout: true}, http.StatusGatewayTimeout, "upstream_connect_timeout"},
+		{"timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, http.StatusGatewayTimeout, "upstream_connect_timeout"},
+		{"early close", &url.Error{Op: "Post", URL: "http://webui", Err: io.EOF}, http.StatusBadGateway, "upstream_closed"},
+		{"other", errors.New("connection reset"), http.StatusBadGateway, "upstream_connection_error"},
+	}
+	for _, tt := range tests {
+		c := classifyConnError(tt.err)
+		if c.status != tt.status || c.code != tt.code {
+			t.Errorf("%s: Expected %d %s, got %d %s", tt.name, tt.status, tt.code, c.status, c.code)
+		}
+	}
+}
+
+func TestHandleChatCompletionsConnErrors(t *testing.T) {
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	refusedURL := "http://" + refused.Addr().String()
+	refused.Close()
+
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		code string
+	}{
+		{"refused", refusedURL, "upstream_connection_refused"},
+		{"untrusted certificate", tlsServer.URL, "upstream_tls_error"},
+	}
+	for _, tt := range tests {
+		h := &handler{Config: &Config{OpenWebUIURL: tt.url}}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusBadGateway, w.Code)
+		}
+		var errResp OpenAIErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+			t.Fatalf("%s: Failed to decode error response: %v", tt.name, err)
+		}
+		if errResp.Error.Code != tt.code {
+			t.Errorf("%s: Expected error code %s, got %s", tt.name, tt.code, errResp.Error.Code)
+		}
+	}
+}
+
+func TestHandleChatCompletionsUpstreamClosed(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Failed to hijack connection: %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	send := func(cfg *Config) *httptest.ResponseRecorder {
+		calls.Store(0)
+		h := newHandler(cfg)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	w := send(&Config{OpenWebUIURL: upstream.URL, MaxRetries: 1})
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errResp.Error.Code != "upstream_closed" || errResp.Error.Message != "Upstream closed connection before responding" {
+		t.Errorf("Expected upstream_closed error, got %s: %s", errResp.Error.Code, errResp.Error.Message)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the sent POST not to be retried by default, got %d upstream calls", n)
+	}
+
+	w = send(&Config{OpenWebUIURL: upstream.URL, MaxRetries: 1, RetryOnEarlyClose: true})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d with RetryOnEarlyClose, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 upstream calls with RetryOnEarlyClose, got %d", n)
+	}
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Content part types accepted in multimodal chat messages.
+const (
+	contentPartText     = "text"
+	contentPartImageURL = "image_url"
+)
+
+// ContentPart is one element of a multimodal message content array.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// messageItemJSON mirrors MessageItem with content left undecoded.
+type messageItemJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// UnmarshalJSON accepts content both as a plain string and as an array of
+// content parts. For parts, Content is set to their concatenated text so that
+// text-based checks such as the prompt length limit still apply.
+func (m *MessageItem) UnmarshalJSON(data []byte) error {
+	var raw messageItemJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = MessageItem{Role: raw.Role, ToolCalls: raw.ToolCalls, ToolCallID: raw.ToolCallID}
+	content := strings.TrimSpace(string(raw.Content))
+	switch {
+	case content == "" || content == "null":
+	case content[0] == '[':
+		if err := json.Unmarshal(raw.Content, &m.Parts); err != nil {
+			return err
+		}
+		var text strings.Builder
+		for _, part := range m.Parts {
+			text.WriteString(part.Text)
+		}
+		m.Content = text.String()
+	default:
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+	return nil
+}
+
+// MarshalJSON writes Parts as the content array when present, which is the
+// multimodal shape Open-WebUI expects, and the plain Content string otherwise.
+func (m MessageItem) MarshalJSON() ([]byte, error) {
+	var content any = m.Content
+	if m.Parts != nil {
+		content = m.Parts
+	}
+	return json.Marshal(struct {
+		Role       string     `json:"role"`
+		Content    any        `json:"content"`
+		ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+		ToolCallID string     `json:"tool_call_id,omitempty"`
+	}{m.Role, content, m.ToolCalls, m.ToolCallID})
+}
+
+// validateContentParts checks the content parts of all messages, rejecting
+// unknown part types and image parts without a usable URL. Inline images must
+// be base64 encoded image data URLs.
+func validateContentParts(messages []MessageItem) error {
+	for i, m := range messages {
+		for j, part := range m.Parts {
+			switch part.Type {
+			case contentPartText:
+			case contentPartImageURL:
+				if part.ImageURL == nil || part.ImageURL.URL == "" {
+					return fmt.Errorf("messages[%d].content[%d]: image_url part without a url", i, j)
+				}
+				if err := validateImageURL(part.ImageURL.URL); err != nil {
+					return fmt.Errorf("messages[%d].content[%d]: %w", i, j, err)
+				}
+			default:
+				return fmt.Errorf("messages[%d].content[%d]: unsupported content part type %q", i, j, part.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// validateImageURL accepts http(s) URLs and data:image/<type>;base64,<data> URLs
+// whose payload is valid base64.
+func validateImageURL(url string) error {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return nil
+	}
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return fmt.Errorf("image url must be an http(s) or data URL")
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return fmt.Errorf("malformed data URL: missing data")
+	}
+	mediaType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return fmt.Errorf("malformed data URL: image data must be base64 encoded")
+	}
+	if !strings.HasPrefix(mediaType, "image/") || len(mediaType) == len("image/") {
+		return fmt.Errorf("malformed data URL: media type %q is not an image", mediaType)
+	}
+	if data == "" {
+		return fmt.Errorf("malformed data URL: empty image data")
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return fmt.Errorf("malformed data URL: invalid base64 image data")
+	}
+	return nil
+}
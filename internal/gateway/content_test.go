@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// pngDataURL is a 1x1 transparent PNG.
+const pngDataURL = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+
+func TestHandleChatCompletionsImagePart(t *testing.T) {
+	reqBody := `{"model": "vision-model", "messages": [{"role": "user", "content": [
+		{"type": "text", "text": "What is this?"},
+		{"type": "image_url", "image_url": {"url": "` + pngDataURL + `"}}
+	]}]}`
+	payload := captureUpstreamPayload(t, &Config{}, reqBody)
+
+	messages, _ := payload["messages"].([]any)
+	if len(messages) != 1 {
+		t.Fatalf("Expected one forwarded message, got %v", payload["messages"])
+	}
+	parts, ok := messages[0].(map[string]any)["content"].([]any)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("Expected the content parts to be forwarded as an array, got %v", messages[0])
+	}
+	text, _ := parts[0].(map[string]any)
+	if text["type"] != "text" || text["text"] != "What is this?" {
+		t.Errorf("Expected the text part to be forwarded, got %v", parts[0])
+	}
+	image, _ := parts[1].(map[string]any)
+	imageURL, _ := image["image_url"].(map[string]any)
+	if image["type"] != "image_url" || imageURL["url"] != pngDataURL {
+		t.Errorf("Expected the image part to be forwarded unchanged, got %v", parts[1])
+	}
+}
+
+func TestHandleChatCompletionsMalformedImagePart(t *testing.T) {
+	tests := map[string]string{
+		"missing base64 marker": "data:image/png,iVBORw0KGgo=",
+		"invalid base64":        "data:image/png;base64,not*base64!",
+		"not an image":          "data:text/plain;base64,aGVsbG8=",
+		"empty data":            "data:image/png;base64,",
+		"unsupported scheme":    "file:///etc/passwd",
+	}
+	for name, url := range tests {
+		h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+		reqBody := `{"model": "vision-model", "messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "` + url + `"}}]}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+
+		h.handleChatCompletions(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status code %d, got %d", name, http.StatusBadRequest, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "messages[0].content[0]") {
+			t.Errorf("%s: Expected the error to point at the part, got %q", name, w.Body.String())
+		}
+	}
+}
+
+func TestMessageItemJSON(t *testing.T) {
+	var m MessageItem
+	if err := json.Unmarshal([]byte(`{"role": "user", "content": [{"type": "text", "text": "Hel"}, {"type": "text", "text": "lo"}]}`), &m); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if m.Content != "Hello" || len(m.Parts) != 2 {
+		t.Errorf("Expected concatenated text and two parts, got %+v", m)
+	}
+
+	data, err := json.Marshal(MessageItem{Role: "assistant", Content: "Hi"})
+	if err != nil {
+		t.Fatalf("Failed to encode message: %v", err)
+	}
+	if string(data) != `{"role":"assistant","content":"Hi"}` {
+		t.Errorf("Expected a plain string content, got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"role": "assistant", "content": null}`), &m); err != nil || m.Content != "" || m.Parts != nil {
+		t.Errorf("Expected null content to decode as empty, got %+v (%v)", m, err)
+	}
+}
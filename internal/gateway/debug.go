@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// redactedValue replaces secrets in debug output.
+const redactedValue = "***"
+
+// redacted returns a copy of the configuration with secrets masked.
+func (c Config) redacted() Config {
+	if c.OpenWebUIAPIKey != "" {
+		c.OpenWebUIAPIKey = redactedValue
+	}
+	c.OpenWebUIURL = redactURL(c.OpenWebUIURL)
+	c.UpstreamProxy = redactURL(c.UpstreamProxy)
+	if c.ShutdownWebhook != "" {
+		// Webhook URLs commonly carry their token in the path.
+		c.ShutdownWebhook = redactedValue
+	}
+	return c
+}
+
+// redactURL masks the password and drops the query and fragment of raw, which
+// may carry tokens. An unparsable URL is masked entirely.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = "", false, "", ""
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	// url.UserPassword would escape the mask.
+	userinfo := url.User(u.User.Username()).String() + ":" + redactedValue + "@"
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+userinfo, 1)
+}
+
+// handleDebugConfig returns the effective configuration with secrets redacted.
+func (h *handler) handleDebugConfig(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Config.redacted()); err != nil {
+		log.Error(err, "Failed to encode debug config")
+	}
+}
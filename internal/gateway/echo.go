@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"encoding/json"
+)
+
+// requestEchoHeader carries the sanitized parsed chat request when Config.EchoRequest is set.
+const requestEchoHeader = "X-Request-Echo"
+
+// requestEcho summarizes a parsed chat request without any message content.
+type requestEcho struct {
+	Model      string         `json:"model"`
+	Stream     bool           `json:"stream"`
+	N          int            `json:"n"`
+	Roles      []string       `json:"roles"`
+	PipelineID string         `json:"pipeline_id,omitempty"`
+	Params     map[string]any `json:"params,omitempty"`
+}
+
+// echoRequest returns the JSON echo of req as a header value. Only roles of
+// the messages are kept; their content, tool calls and attachments are never
+// included.
+func echoRequest(req OpenAIChatRequest, n int) string {
+	echo := requestEcho{
+		Model:      req.Model,
+		Stream:     req.Stream,
+		N:          n,
+		Roles:      make([]string, len(req.Messages)),
+		PipelineID: req.PipelineID,
+		Params:     map[string]any{},
+	}
+	for i, m := range req.Messages {
+		echo.Roles[i] = m.Role
+	}
+	setParam := func(name string, set bool, v any) {
+		if set {
+			echo.Params[name] = v
+		}
+	}
+	setParam("frequency_penalty", req.FrequencyPenalty != nil, deref(req.FrequencyPenalty))
+	setParam("presence_penalty", req.PresencePenalty != nil, deref(req.PresencePenalty))
+	setParam("max_completion_tokens", req.MaxCompletionTokens != nil, deref(req.MaxCompletionTokens))
+	setParam("logprobs", req.Logprobs != nil, deref(req.Logprobs))
+	setParam("top_logprobs", req.TopLogprobs != nil, deref(req.TopLogprobs))
+	setParam("service_tier", req.ServiceTier != nil, deref(req.ServiceTier))
+	setParam("parallel_tool_calls", req.ParallelToolCalls != nil, deref(req.ParallelToolCalls))
+	setParam("store", req.Store != nil, deref(req.Store))
+	setParam("logit_bias", len(req.LogitBias) > 0, true)
+	setParam("metadata", len(req.Metadata) > 0, true)
+
+	data, err := json.Marshal(echo)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// deref returns the value p points to, or the zero value for nil.
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestEchoRequestHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	send := func(cfg *Config) *httptest.ResponseRecorder {
+		cfg.OpenWebUIURL = ts.URL
+		h := &handler{Config: cfg}
+		body := `{"messages": [{"role": "system", "content": "Top secret"}, {"role": "user", "content": "Secret question"}], "max_tokens": 64, "presence_penalty": 0.5}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		return w
+	}
+
+	w := send(&Config{DefaultModel: "test-model", EchoRequest: true})
+	raw := w.Header().Get("X-Request-Echo")
+	if strings.Contains(raw, "ecret") {
+		t.Errorf("Expected message content to be redacted from the echo, got %s", raw)
+	}
+	var echo requestEcho
+	if err := json.Unmarshal([]byte(raw), &echo); err != nil {
+		t.Fatalf("Failed to decode request echo %q: %v", raw, err)
+	}
+	if echo.Model != "test-model" || echo.Stream || echo.N != 1 {
+		t.Errorf("Expected the echo to reflect the parsed request, got %+v", echo)
+	}
+	if !slices.Equal(echo.Roles, []string{"system", "user"}) {
+		t.Errorf("Expected message roles in the echo, got %v", echo.Roles)
+	}
+	if echo.Params["max_completion_tokens"] != float64(64) || echo.Params["presence_penalty"] != 0.5 {
+		t.Errorf("Expected the mapped parameters in the echo, got %v", echo.Params)
+	}
+	if _, ok := echo.Params["frequency_penalty"]; ok {
+		t.Errorf("Expected unset parameters to be omitted, got %v", echo.Params)
+	}
+
+	if w := send(&Config{DefaultModel: "test-model"}); w.Header().Get("X-Request-Echo") != "" {
+		t.Errorf("Expected no request echo unless enabled")
+	}
+}
@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// newEndpointLimits creates one semaphore per path of Config.EndpointConcurrency.
+func newEndpointLimits(limits map[string]int) map[string]chan struct{} {
+	if len(limits) == 0 {
+		return nil
+	}
+	sems := make(map[string]chan struct{}, len(limits))
+	for path, n := range limits {
+		sems[path] = make(chan struct{}, n)
+	}
+	return sems
+}
+
+// withEndpointLimit is a middleware that enforces Config.EndpointConcurrency.
+// A request to a saturated endpoint is rejected with 503 right away instead of
+// waiting, so that cheap endpoints stay available while an expensive one is busy.
+func (h *handler) withEndpointLimit(next http.HandlerFunc) http.HandlerFunc {
+	if len(h.endpoints) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		sem, ok := h.endpoints[r.URL.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			logger.FromContext(r.Context()).Info("Rejected request over the endpoint concurrency limit", "path", r.URL.Path, "limit", cap(sem))
+			w.Header().Set("Retry-After", "1")
+			writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "endpoint_busy",
+				"Too many concurrent requests to "+r.URL.Path+", retry later")
+			return
+		}
+		defer func() { <-sem }()
+		next.ServeHTTP(w, r)
+	}
+}
+
+// parseEndpointConcurrency parses "path=limit" flag values into a limit map.
+func parseEndpointConcurrency(values []string) (map[string]int, error) {
+	limits := make(map[string]int, len(values))
+	for _, v := range values {
+		path, limit, ok := strings.Cut(v, "=")
+		path = strings.TrimSpace(path)
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || !strings.HasPrefix(path, "/") || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid endpoint concurrency %q, expected \"path=limit\" with a positive limit, e.g. /v1/chat/completions=10", v)
+		}
+		limits[path] = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestEndpointConcurrency(t *testing.T) {
+	chatStarted := make(chan struct{})
+	releaseChat := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat" {
+			chatStarted <- struct{}{}
+			<-releaseChat
+			json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: upstream.URL, EndpointConcurrency: map[string]int{"/v1/chat/completions": 1}}
+	h := newHandler(cfg)
+	mainSrv, _ := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mainSrv.Handler.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+	chatBody := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send(http.MethodPost, "/v1/chat/completions", chatBody) }()
+	<-chatStarted
+
+	w := send(http.MethodPost, "/v1/chat/completions", chatBody)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d for a saturated chat endpoint, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil || errResp.Error.Code != "endpoint_busy" {
+		t.Errorf("Expected an endpoint_busy error, got %+v (%v)", errResp, err)
+	}
+	if w := send(http.MethodGet, "/v1/models", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected /v1/models to be served while the chat endpoint is saturated, got %d", w.Code)
+	}
+
+	close(releaseChat)
+	if w := <-first; w.Code != http.StatusOK {
+		t.Errorf("Expected the first chat request to succeed, got %d", w.Code)
+	}
+	go func() { <-chatStarted }()
+	if w := send(http.MethodPost, "/v1/chat/completions", chatBody); w.Code != http.StatusOK {
+		t.Errorf("Expected the chat endpoint to accept requests once freed, got %d", w.Code)
+	}
+}
+
+func TestParseEndpointConcurrency(t *testing.T) {
+	limits, err := parseEndpointConcurrency([]string{"/v1/chat/completions=10", " /v1/models = 2 "})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if limits["/v1/chat/completions"] != 10 || limits["/v1/models"] != 2 {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+	for _, v := range []string{"/v1/models", "v1/models=2", "/v1/models=0", "/v1/models=x"} {
+		if _, err := parseEndpointConcurrency([]string{v}); err == nil {
+			t.Errorf("Expected an error for %q", v)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// compileBlockedPatterns compiles Config.BlockedPatterns.
+func compileBlockedPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// blockedContent returns the index of the first message whose text content
+// matches one of the blocked patterns and the pattern, or -1 if none matches.
+func blockedContent(blocked []*regexp.Regexp, messages []MessageItem) (int, string) {
+	for i, m := range messages {
+		for _, re := range blocked {
+			if re.MatchString(m.Content) {
+				return i, re.String()
+			}
+		}
+	}
+	return -1, ""
+}
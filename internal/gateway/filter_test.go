@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestHandleChatCompletionsBlockedPatterns(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, BlockedPatterns: []string{`(?i)project\s+x`, "forbidden"}})
+	tests := []struct {
+		name    string
+		body    string
+		blocked bool
+	}{
+		{"allowed", `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`, false},
+		{"regex", `{"model": "test-model", "messages": [{"role": "user", "content": "Tell me about PROJECT  X"}]}`, true},
+		{"later message", `{"model": "test-model", "messages": [{"role": "system", "content": "Be nice"}, {"role": "user", "content": "a forbidden word"}]}`, true},
+		{"content parts", `{"model": "test-model", "messages": [{"role": "user", "content": [{"type": "text", "text": "forbidden"}]}]}`, true},
+	}
+	for _, tt := range tests {
+		calls = 0
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(tt.body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+
+		if !tt.blocked {
+			if w.Code != http.StatusOK || calls != 1 {
+				t.Errorf("%s: Expected the request to be forwarded, got status %d after %d upstream calls", tt.name, w.Code, calls)
+			}
+			continue
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusBadRequest, w.Code)
+		}
+		var errResp OpenAIErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+			t.Fatalf("%s: Failed to decode error response: %v", tt.name, err)
+		}
+		if errResp.Error.Code != "content_filter" {
+			t.Errorf("%s: Expected error code content_filter, got %s", tt.name, errResp.Error.Code)
+		}
+		if calls != 0 {
+			t.Errorf("%s: Expected blocked content not to be forwarded, got %d upstream calls", tt.name, calls)
+		}
+	}
+}
+
+func TestCompileBlockedPatterns(t *testing.T) {
+	if _, err := compileBlockedPatterns([]string{"ok", "(unclosed"}); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// ipLimiter counts the in-flight requests of each client IP.
+type ipLimiter struct {
+	limit int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newIPLimiter(limit int) *ipLimiter {
+	return &ipLimiter{limit: limit, active: map[string]int{}}
+}
+
+// acquire reserves a slot for ip, reporting false if it already has limit
+// requests in flight.
+func (l *ipLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] >= l.limit {
+		return false
+	}
+	l.active[ip]++
+	return true
+}
+
+func (l *ipLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip]--; l.active[ip] <= 0 {
+		delete(l.active, ip)
+	}
+}
+
+// withIPLimit is a middleware that rejects a request with 429 when its client
+// already has Config.MaxConnsPerIP requests in flight, so a single client
+// cannot hold an unbounded number of connections, especially streams.
+func (h *handler) withIPLimit(next http.HandlerFunc) http.HandlerFunc {
+	if h.Config.MaxConnsPerIP <= 0 {
+		return next
+	}
+	limiter := newIPLimiter(h.Config.MaxConnsPerIP)
+	trusted, _ := parseTrustedProxies(h.Config.TrustedProxies)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := forwardedClientIP(trusted, r)
+		if !limiter.acquire(ip) {
+			logger.FromContext(r.Context()).Info("Rejected request over the per-client connection limit", "client_ip", ip, "max_conns_per_ip", h.Config.MaxConnsPerIP)
+			writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", "too_many_connections",
+				"Too many concurrent requests from this client, retry later")
+			return
+		}
+		defer limiter.release(ip)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// forwardedClientIP returns the IP of the client of r. Requests relayed by one
+// of the trusted proxies are attributed to the right-most X-Forwarded-For entry
+// that is not itself a trusted proxy; the header is ignored otherwise, since any
+// client could set it.
+func forwardedClientIP(trusted []*net.IPNet, r *http.Request) string {
+	ip := clientIP(r)
+	if !isTrusted(trusted, ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
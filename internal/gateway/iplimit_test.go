@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestMaxConnsPerIP(t *testing.T) {
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: upstream.URL, MaxConnsPerIP: 2, TrustedProxies: []string{"10.0.0.1"}}
+	mainSrv, _ := setupServers(ctx, cfg, newHandler(cfg), make(chan struct{}), &sync.Once{})
+	send := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		mainSrv.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Two requests of one client relayed by the trusted proxy fill its slots.
+	results := make(chan *httptest.ResponseRecorder, 2)
+	for i := 0; i < 2; i++ {
+		go func() { results <- send("10.0.0.1:1234", "192.0.2.1") }()
+		<-started
+	}
+
+	w := send("10.0.0.1:1234", "192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d for a client over the limit, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil || errResp.Error.Code != "too_many_connections" {
+		t.Errorf("Expected a too_many_connections error, got %+v (%v)", errResp, err)
+	}
+
+	// Another client behind the same proxy is unaffected.
+	go func() { results <- send("10.0.0.1:1234", "192.0.2.2") }()
+	<-started
+	close(release)
+	for i := 0; i < 3; i++ {
+		if w := <-results; w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for requests within the limit, got %d", http.StatusOK, w.Code)
+		}
+	}
+	if w := send("10.0.0.1:1234", "192.0.2.1"); w.Code != http.StatusOK {
+		t.Errorf("Expected the client to be accepted once its requests completed, got %d", w.Code)
+	}
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	trusted, _ := parseTrustedProxies([]string{"10.0.0.0/8"})
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"10.0.0.1:1234", "garbage", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := forwardedClientIP(trusted, req); got != tt.want {
+			t.Errorf("forwardedClientIP(%s, %q) = %s, want %s", tt.remoteAddr, tt.forwardedFor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// maintenanceRetryAfterSec is the Retry-After hint sent while in maintenance mode.
+const maintenanceRetryAfterSec = 30
+
+// maintenanceStatus is the /maintenance response.
+type maintenanceStatus struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// withMaintenance is a middleware that answers every request with a 503 while
+// maintenance mode is enabled, so Open-WebUI can be serviced without restarting
+// the gateway.
+func (h *handler) withMaintenance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.maintenance.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logger.FromContext(r.Context()).V(1).Info("Rejected request during maintenance", "method", r.Method, "path", r.URL.Path)
+		w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfterSec))
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "maintenance",
+			"The gateway is in maintenance mode, please retry later")
+	}
+}
+
+// handleMaintenance reports maintenance mode on GET, enables it on POST and
+// disables it on DELETE. It is served on the local quit server only.
+func (h *handler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !h.maintenance.Swap(true) {
+			log.Info("Maintenance mode enabled")
+		}
+	case http.MethodDelete:
+		if h.maintenance.Swap(false) {
+			log.Info("Maintenance mode disabled")
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(maintenanceStatus{Maintenance: h.maintenance.Load()}); err != nil {
+		log.Error(err, "Failed to encode maintenance status")
+	}
+}
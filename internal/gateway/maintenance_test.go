@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat" {
+			json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: upstream.URL}
+	h := newHandler(cfg)
+	mainSrv, quitSrv := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	toggle := func(method string) maintenanceStatus {
+		t.Helper()
+		w := httptest.NewRecorder()
+		quitSrv.Handler.ServeHTTP(w, httptest.NewRequest(method, "/maintenance", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d from %s /maintenance, got %d", http.StatusOK, method, w.Code)
+		}
+		var status maintenanceStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode maintenance status: %v", err)
+		}
+		return status
+	}
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mainSrv.Handler.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+	chatBody := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+
+	if status := toggle(http.MethodPost); !status.Maintenance {
+		t.Fatalf("Expected maintenance mode to be enabled")
+	}
+	for _, path := range []string{"/v1/chat/completions", "/v1/models"} {
+		method := http.MethodGet
+		if path == "/v1/chat/completions" {
+			method = http.MethodPost
+		}
+		w := send(method, path, chatBody)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d for %s during maintenance, got %d", http.StatusServiceUnavailable, path, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected a Retry-After header for %s during maintenance", path)
+		}
+	}
+	if w := send(http.MethodGet, "/healthz", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "DEGRADED") {
+		t.Errorf("Expected health to be answered as degraded, got %d %q", w.Code, w.Body.String())
+	}
+	if status := toggle(http.MethodGet); !status.Maintenance {
+		t.Errorf("Expected GET to report maintenance mode as enabled")
+	}
+
+	if status := toggle(http.MethodDelete); status.Maintenance {
+		t.Fatalf("Expected maintenance mode to be disabled")
+	}
+	if w := send(http.MethodPost, "/v1/chat/completions", chatBody); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d after maintenance, got %d", http.StatusOK, w.Code)
+	}
+	if w := send(http.MethodGet, "/healthz", ""); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("Expected healthy status after maintenance, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleMaintenanceMethodNotAllowed(t *testing.T) {
+	h := &handler{Config: &Config{}}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/maintenance", nil)
+	h.handleMaintenance(w, req.WithContext(logr.NewContext(context.Background(), logr.Discard())))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
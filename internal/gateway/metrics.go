@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// metricsNamespace prefixes all gateway metric names.
+	metricsNamespace = "openai_gateway"
+	// maxModelLabels bounds the number of distinct model label values.
+	maxModelLabels = 50
+	// otherModelLabel is used for models seen after maxModelLabels is reached.
+	otherModelLabel = "other"
+)
+
+// metrics holds the Prometheus collectors exposed on /metrics.
+type metrics struct {
+	registry         *prometheus.Registry
+	promptTokens     *prometheus.CounterVec
+	completionTokens *prometheus.CounterVec
+	totalTokens      *prometheus.CounterVec
+	bodyBytes        prometheus.Histogram
+	bodyRejected     prometheus.Counter
+	requests         *prometheus.CounterVec
+	activeStreams    prometheus.Gauge
+	retries          *prometheus.CounterVec
+	retrySuccesses   prometheus.Counter
+
+	mu     sync.Mutex
+	models map[string]struct{}
+}
+
+// newMetrics creates the gateway collectors on a dedicated registry.
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		promptTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "prompt_tokens_total",
+			Help:      "Total number of prompt tokens reported for chat completions.",
+		}, []string{"model"}),
+		completionTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "completion_tokens_total",
+			Help:      "Total number of completion tokens reported for chat completions.",
+		}, []string{"model"}),
+		totalTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tokens_total",
+			Help:      "Total number of tokens reported for chat completions.",
+		}, []string{"model"}),
+		bodyBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_body_bytes",
+			Help:      "Size of inbound request bodies read by the gateway.",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+		}),
+		bodyRejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_body_rejected_total",
+			Help:      "Total number of requests rejected for exceeding the maximum body size.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Total number of requests by logical route and response status code.",
+		}, []string{"route", "code"}),
+		activeStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_streams",
+			Help:      "Number of chat completion streams currently being served.",
+		}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_retries_total",
+			Help:      "Total number of upstream retries by the status class of the failed attempt, or connection.",
+		}, []string{"class"}),
+		retrySuccesses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_retry_successes_total",
+			Help:      "Total number of upstream requests that succeeded after at least one retry.",
+		}),
+		models: make(map[string]struct{}),
+	}
+	m.registry.MustRegister(m.promptTokens, m.completionTokens, m.totalTokens, m.bodyBytes, m.bodyRejected, m.requests, m.activeStreams,
+		m.retries, m.retrySuccesses)
+	return m
+}
+
+// handler returns the HTTP handler serving the metrics in Prometheus format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// modelLabel returns the label value for model, folding models beyond
+// maxModelLabels into a single value to keep label cardinality bounded.
+func (m *metrics) modelLabel(model string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.models[model]; ok {
+		return model
+	}
+	if len(m.models) >= maxModelLabels {
+		return otherModelLabel
+	}
+	m.models[model] = struct{}{}
+	return model
+}
+
+// observeUsage records the token usage of a chat completion.
+func (m *metrics) observeUsage(model string, usage TokenUsage) {
+	if m == nil {
+		return
+	}
+	label := m.modelLabel(model)
+	m.promptTokens.WithLabelValues(label).Add(float64(usage.PromptTokens))
+	m.completionTokens.WithLabelValues(label).Add(float64(usage.CompletionTokens))
+	m.totalTokens.WithLabelValues(label).Add(float64(usage.TotalTokens))
+}
+
+// observeBody records the size of a fully read request body, or a rejection
+// when the body exceeded the size limit.
+func (m *metrics) observeBody(size int64, rejected bool) {
+	if m == nil {
+		return
+	}
+	if rejected {
+		m.bodyRejected.Inc()
+		return
+	}
+	m.bodyBytes.Observe(float64(size))
+}
+
+// observeRequest records a response with status on route, see withRoute.
+func (m *metrics) observeRequest(route string, status int) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+}
+
+// trackStream counts a chat completion stream as active until the returned
+// function is called.
+func (m *metrics) trackStream() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.activeStreams.Inc()
+	return m.activeStreams.Dec
+}
+
+// observeRetry records an upstream retry after an attempt of class, see retryClass.
+func (m *metrics) observeRetry(class string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(class).Inc()
+}
+
+// observeRetrySuccess records an upstream request that succeeded after retrying.
+func (m *metrics) observeRetrySuccess() {
+	if m == nil {
+		return
+	}
+	m.retrySuccesses.Inc()
+}
@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsTokenUsage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{
+			Message: MessageItem{Role: "assistant", Content: "Hi"},
+			Usage:   &TokenUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+		})
+	}))
+	defer ts.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: ts.URL, Metrics: true})
+	for i := 0; i < 2; i++ {
+		body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+
+	if v := testutil.ToFloat64(h.metrics.promptTokens.WithLabelValues("test-model")); v != 14 {
+		t.Errorf("Expected 14 prompt tokens, got %v", v)
+	}
+	if v := testutil.ToFloat64(h.metrics.completionTokens.WithLabelValues("test-model")); v != 6 {
+		t.Errorf("Expected 6 completion tokens, got %v", v)
+	}
+	if v := testutil.ToFloat64(h.metrics.totalTokens.WithLabelValues("test-model")); v != 20 {
+		t.Errorf("Expected 20 total tokens, got %v", v)
+	}
+
+	w := httptest.NewRecorder()
+	h.metrics.handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !bytes.Contains(w.Body.Bytes(), []byte(`openai_gateway_tokens_total{model="test-model"} 20`)) {
+		t.Errorf("Expected /metrics to expose the token counters, got:\n%s", w.Body.String())
+	}
+}
+
+func TestMetricsModelLabelBounded(t *testing.T) {
+	m := newMetrics()
+	for i := 0; i < maxModelLabels; i++ {
+		if label := m.modelLabel(fmt.Sprintf("model-%d", i)); label != fmt.Sprintf("model-%d", i) {
+			t.Fatalf("Expected model-%d to keep its own label, got %s", i, label)
+		}
+	}
+	if label := m.modelLabel("one-too-many"); label != otherModelLabel {
+		t.Errorf("Expected overflow model to be labeled %s, got %s", otherModelLabel, label)
+	}
+	if label := m.modelLabel("model-0"); label != "model-0" {
+		t.Errorf("Expected known model to keep its label, got %s", label)
+	}
+}
+
+func TestMetricsRequestBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer ts.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: ts.URL, Metrics: true, MaxBodyBytes: 256})
+	send := func(body string) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.limitBody(h.handleRoot)(w, req)
+		return w.Code
+	}
+
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+	if code := send(body); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if code := send(`{"model": "test-model", "messages": [{"role": "user", "content": "` + strings.Repeat("x", 512) + `"}]}`); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, code)
+	}
+
+	w := httptest.NewRecorder()
+	h.metrics.handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"openai_gateway_request_body_bytes_count 1",
+		fmt.Sprintf("openai_gateway_request_body_bytes_sum %d", len(body)),
+		"openai_gateway_request_body_rejected_total 1",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestMetricsActiveStreams(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hel\"}}\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: ts.URL, Metrics: true})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.handleChatCompletions(httptest.NewRecorder(), newStreamRequest(t))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(h.metrics.activeStreams) != 1 {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("Expected one active stream, got %v", testutil.ToFloat64(h.metrics.activeStreams))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	<-done
+	if v := testutil.ToFloat64(h.metrics.activeStreams); v != 0 {
+		t.Errorf("Expected no active streams after the stream ended, got %v", v)
+	}
+}
+
+func TestMetricsUpstreamRetries(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: ts.URL, Metrics: true, MaxRetries: 3, RetryBackoffMs: 1})
+	req := httptest.NewRequest("GET", "/v1/embeddings", nil)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.handleRoot(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d after retrying, got %d", http.StatusOK, w.Code)
+	}
+
+	if v := testutil.ToFloat64(h.metrics.retries.WithLabelValues("5xx")); v != 2 {
+		t.Errorf("Expected 2 retries after 5xx responses, got %v", v)
+	}
+	if v := testutil.ToFloat64(h.metrics.retrySuccesses); v != 1 {
+		t.Errorf("Expected 1 request succeeding after retries, got %v", v)
+	}
+	if retryClass(nil) != "connection" {
+		t.Errorf("Expected retries without a response to be labeled connection, got %s", retryClass(nil))
+	}
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// hookWriter wraps a ResponseWriter and calls onWriteHeader exactly once, right
+// before the response headers are committed. The hook may adjust the headers
+// and returns the status code to send.
+type hookWriter struct {
+	http.ResponseWriter
+	onWriteHeader func(h http.Header, status int) int
+	wroteHeader   bool
+}
+
+func (w *hookWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		status = w.onWriteHeader(w.Header(), status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so that streaming keeps working through the wrapper.
+func (w *hookWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withResponseHeaders is a middleware that adds Config.ResponseHeaders to every
+// response. Headers already set by a handler, and Content-Type in particular,
+// are never overwritten.
+func (h *handler) withResponseHeaders(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(h.Config.ResponseHeaders) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hw := &hookWriter{ResponseWriter: w, onWriteHeader: func(header http.Header, status int) int {
+			for name, value := range h.Config.ResponseHeaders {
+				if http.CanonicalHeaderKey(name) == "Content-Type" || header.Get(name) != "" {
+					continue
+				}
+				header.Set(name, value)
+			}
+			return status
+		}}
+		next.ServeHTTP(hw, r)
+	}
+}
+
+// withStatusRemap is a middleware that rewrites response status codes according
+// to Config.StatusRemap, for clients that handle some codes poorly. The status is
+// rewritten right before headers are committed, so a stream that has already
+// started with 200 OK is never affected by a later failure.
+func (h *handler) withStatusRemap(next http.HandlerFunc) http.HandlerFunc {
+	if len(h.Config.StatusRemap) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		hw := &hookWriter{ResponseWriter: w, onWriteHeader: func(_ http.Header, status int) int {
+			if to, ok := h.Config.StatusRemap[status]; ok {
+				return to
+			}
+			return status
+		}}
+		next.ServeHTTP(hw, r)
+	}
+}
+
+// parseStatusRemap parses "from=>to" flag values into a status code map.
+func parseStatusRemap(values []string) (map[int]int, error) {
+	remap := make(map[int]int, len(values))
+	for _, v := range values {
+		from, to, ok := strings.Cut(v, "=>")
+		fromCode, fromErr := strconv.Atoi(strings.TrimSpace(from))
+		toCode, toErr := strconv.Atoi(strings.TrimSpace(to))
+		if !ok || fromErr != nil || toErr != nil || !isRemappableStatus(fromCode) || !isRemappableStatus(toCode) {
+			return nil, fmt.Errorf("invalid status remap %q, expected \"from=>to\" with status codes between 200 and 599", v)
+		}
+		remap[fromCode] = toCode
+	}
+	return remap, nil
+}
+
+// isRemappableStatus reports whether code is a final status code. Informational
+// responses are never remapped.
+func isRemappableStatus(code int) bool {
+	return code >= 200 && code <= 599
+}
+
+// parseResponseHeaders parses "Name: value" flag values into a header map.
+func parseResponseHeaders(values []string) (map[string]string, error) {
+	headers := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid response header %q, expected \"Name: value\"", v)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
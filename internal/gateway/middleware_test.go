@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestWithResponseHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	cfg := &Config{
+		OpenWebUIURL: ts.URL,
+		ResponseHeaders: map[string]string{
+			"Strict-Transport-Security": "max-age=31536000",
+			"X-Content-Type-Options":    "nosniff",
+			"Content-Type":              "text/plain",
+		},
+	}
+	h := &handler{Config: cfg}
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	mainSrv, _ := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	mainSrv.Handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("Expected Strict-Transport-Security header, got %q", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("Expected X-Content-Type-Options header, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected handler Content-Type to be preserved, got %q", got)
+	}
+}
+
+func TestWithResponseHeadersKeepsHandlerValues(t *testing.T) {
+	h := &handler{Config: &Config{ResponseHeaders: map[string]string{"Cache-Control": "no-store"}}}
+	wrapped := h.withResponseHeaders(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.(http.Flusher).Flush()
+	})
+	w := httptest.NewRecorder()
+	wrapped(w, httptest.NewRequest("GET", "/v1/models", nil))
+
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Expected handler header to win, got %q", got)
+	}
+	if !w.Flushed {
+		t.Errorf("Expected Flush to reach the underlying writer")
+	}
+}
+
+func TestParseResponseHeaders(t *testing.T) {
+	headers, err := parseResponseHeaders([]string{"x-frame-options: DENY", "Strict-Transport-Security: max-age=31536000; includeSubDomains"})
+	if err != nil {
+		t.Fatalf("Expected headers to parse, got %v", err)
+	}
+	if headers["X-Frame-Options"] != "DENY" {
+		t.Errorf("Expected canonical X-Frame-Options header, got %v", headers)
+	}
+	if headers["Strict-Transport-Security"] != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Expected full header value, got %q", headers["Strict-Transport-Security"])
+	}
+
+	if _, err := parseResponseHeaders([]string{"missing-separator"}); err == nil {
+		t.Errorf("Expected an error for a header without a separator")
+	}
+}
+
+func TestWithStatusRemap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	cfg := &Config{OpenWebUIURL: ts.URL, StatusRemap: map[int]int{http.StatusBadGateway: http.StatusServiceUnavailable}}
+	h := &handler{Config: cfg}
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	mainSrv, _ := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	w := httptest.NewRecorder()
+	mainSrv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the upstream failure to be remapped to %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	// Codes without a mapping are left alone.
+	w = httptest.NewRecorder()
+	mainSrv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestParseStatusRemap(t *testing.T) {
+	remap, err := parseStatusRemap([]string{"502=>503", " 504 => 503 "})
+	if err != nil {
+		t.Fatalf("Expected status remap to parse, got %v", err)
+	}
+	if remap[502] != 503 || remap[504] != 503 || len(remap) != 2 {
+		t.Errorf("Unexpected status remap %v", remap)
+	}
+	for _, v := range []string{"502", "502=>", "abc=>503", "502=>99", "100=>200"} {
+		if _, err := parseStatusRemap([]string{v}); err == nil {
+			t.Errorf("Expected an error for status remap %q", v)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// modelsPath is the OpenAI models listing route served from the models cache.
+const modelsPath = "/v1/models"
+
+// modelsCache holds the last successful upstream models listing of each caller
+// for ttl. Callers are told apart by modelsCacheKey, so a listing fetched with
+// one client's credentials is never served to another client.
+type modelsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]modelsEntry
+}
+
+type modelsEntry struct {
+	body    []byte
+	header  http.Header
+	fetched time.Time
+}
+
+func newModelsCache(ttl time.Duration) *modelsCache {
+	return &modelsCache{ttl: ttl, entries: map[string]modelsEntry{}}
+}
+
+// get returns the cached listing of key if it is still fresh.
+func (c *modelsCache) get(key string) ([]byte, http.Header, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.fetched) > c.ttl {
+		return nil, nil, false
+	}
+	return e.body, e.header, true
+}
+
+// store caches the listing of key and drops the expired listings of others.
+func (c *modelsCache) store(key string, body []byte, header http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if time.Since(e.fetched) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = modelsEntry{body: body, header: header, fetched: time.Now()}
+}
+
+// clear drops every cached listing.
+func (c *modelsCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// modelsCacheKey returns the models cache key of the caller of r: a hash of
+// its credentials and org headers, which decide what the upstream lists.
+func modelsCacheKey(r *http.Request) string {
+	sum := sha256.New()
+	for _, part := range append([]string{r.Header.Get("Authorization")}, orgHeaderValues(r)...) {
+		sum.Write([]byte(part))
+		sum.Write([]byte{0})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// handleModels serves the models listing from the cache, fetching it from
+// Open-WebUI on a miss. Failed upstream responses are relayed but not cached.
+func (h *handler) handleModels(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context()).WithValues("request_id", randomString(8))
+	if body, header, ok := h.models.get(modelsCacheKey(r)); ok {
+		log.V(1).Info("Serving models listing from cache")
+		writeModels(w, log, http.StatusOK, header, body)
+		return
+	}
+
+	ctx, cancel := h.upstreamContext(logger.WithContext(r.Context(), log), false)
+	defer cancel()
+	status, header, body, err := h.fetchModels(ctx, r)
+	if err != nil {
+		log.Error(err, "Failed to fetch models from upstream")
+		if h.writeUpstreamTimeout(w, ctx, err) {
+			return
+		}
+		writeConnError(w, err)
+		return
+	}
+	writeModels(w, log, status, header, body)
+}
+
+// refreshModels re-fetches the models listing with the configured credentials,
+// bypassing the cache TTL. The listings of other callers are dropped and
+// re-fetched on their next request.
+func (h *handler) refreshModels(ctx context.Context) error {
+	ctx, cancel := h.upstreamContext(ctx, false)
+	defer cancel()
+	h.models.clear()
+	status, _, body, err := h.fetchModels(ctx, &http.Request{Header: http.Header{}})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("upstream returned status %d: %s", status, body)
+	}
+	return nil
+}
+
+// fetchModels requests the models listing from Open-WebUI on behalf of r and
+// caches it for the caller of r when the upstream answers 200 OK.
+func (h *handler) fetchModels(ctx context.Context, r *http.Request) (int, http.Header, []byte, error) {
+	targetURL := h.Config.OpenWebUIURL + "/models"
+	resp, err := h.doUpstream(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		h.setUpstreamAuth(req, r)
+		return req, nil
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	header := http.Header{}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		header.Set("Content-Type", ct)
+	} else if h.Config.DefaultContentType != "" {
+		header.Set("Content-Type", h.Config.DefaultContentType)
+	}
+	if resp.StatusCode == http.StatusOK {
+		body = normalizeModelsList(body)
+		h.models.store(modelsCacheKey(r), body, header)
+	}
+	return resp.StatusCode, header, body, nil
+}
+
+func writeModels(w http.ResponseWriter, log logr.Logger, status int, header http.Header, body []byte) {
+	for k, vv := range header {
+		w.Header()[k] = vv
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Error(err, "Failed to write models listing")
+	}
+}
+
+// handleDebugRefreshModels forces an immediate re-fetch of the cached models listing.
+func (h *handler) handleDebugRefreshModels(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.refreshModels(r.Context()); err != nil {
+		log.Error(err, "Failed to refresh models listing")
+		http.Error(w, "Failed to refresh models: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Info("Refreshed models listing")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emptyModelsList is the OpenAI shape of a listing without models.
+var emptyModelsList = []byte(`{"object":"list","data":[]}`)
+
+// normalizeModelsList turns a successful models listing into the OpenAI list
+// shape. Some upstreams answer with a bare array, or with [], null or nothing
+// at all when no models are available, which OpenAI clients fail to parse. A
+// list object whose data is null or missing gets an empty data array. Bodies
+// that are not JSON are returned unchanged.
+func normalizeModelsList(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return emptyModelsList
+	}
+	var list map[string]json.RawMessage
+	switch trimmed[0] {
+	case '[':
+		var data []json.RawMessage
+		if err := json.Unmarshal(trimmed, &data); err != nil {
+			return body
+		}
+		if len(data) == 0 {
+			return emptyModelsList
+		}
+		list = map[string]json.RawMessage{"object": json.RawMessage(`"list"`), "data": trimmed}
+	case '{':
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return body
+		}
+		if data, ok := list["data"]; ok && string(bytes.TrimSpace(data)) != "null" {
+			return body
+		}
+		list["data"] = json.RawMessage(`[]`)
+		if _, ok := list["object"]; !ok {
+			list["object"] = json.RawMessage(`"list"`)
+		}
+	default:
+		return body
+	}
+	normalized, err := json.Marshal(list)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
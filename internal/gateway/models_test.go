@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// newModelsUpstream serves a models listing naming the current fetch count.
+func newModelsUpstream(t *testing.T, fetches *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			http.NotFound(w, r)
+			return
+		}
+		n := atomic.AddInt32(fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"id": "model-%d"}]}`, n)
+	}))
+}
+
+func getModels(t *testing.T, h *handler) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", modelsPath, nil)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.handleRoot(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestModelsCache(t *testing.T) {
+	var fetches int32
+	upstream := newModelsUpstream(t, &fetches)
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, ModelsCacheTTLSec: 60})
+	first := getModels(t, h)
+	second := getModels(t, h)
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected a single upstream fetch within the TTL, got %d", n)
+	}
+	if first != second {
+		t.Errorf("Expected the cached listing to be served, got %q then %q", first, second)
+	}
+}
+
+func TestModelsCachePerCaller(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"id": %q}]}`, r.Header.Get("Authorization"))
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, ModelsCacheTTLSec: 60})
+	get := func(auth string) string {
+		req := httptest.NewRequest("GET", modelsPath, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleRoot(w, req)
+		return w.Body.String()
+	}
+
+	if got := get("Bearer user-1"); got != `{"data": [{"id": "Bearer user-1"}]}` {
+		t.Fatalf("Unexpected listing for user-1 %q", got)
+	}
+	if got := get(""); got != `{"data": [{"id": ""}]}` {
+		t.Errorf("Expected an unauthenticated caller not to get the listing of user-1, got %q", got)
+	}
+	if got := get("Bearer user-2"); got != `{"data": [{"id": "Bearer user-2"}]}` {
+		t.Errorf("Expected user-2 not to get the listing of another caller, got %q", got)
+	}
+	get("Bearer user-1")
+	if n := fetches.Load(); n != 3 {
+		t.Errorf("Expected one upstream fetch per caller, got %d", n)
+	}
+}
+
+func TestDebugRefreshModels(t *testing.T) {
+	var fetches int32
+	upstream := newModelsUpstream(t, &fetches)
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: upstream.URL, QuitPort: findAvailablePort(t), Debug: true, ModelsCacheTTLSec: 60}
+	h := newHandler(cfg)
+	var closeOnce sync.Once
+	_, quitSrv := setupServers(ctx, cfg, h, make(chan struct{}), &closeOnce)
+
+	if got := getModels(t, h); got != `{"data": [{"id": "model-1"}]}` {
+		t.Fatalf("Unexpected initial listing %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	quitSrv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/debug/refresh-models", nil).WithContext(ctx))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("Expected the refresh to fetch from upstream, got %d fetches", n)
+	}
+	if got := getModels(t, h); got != `{"data": [{"id": "model-2"}]}` {
+		t.Errorf("Expected the refreshed listing to be cached, got %q", got)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("Expected the refreshed listing to be served from cache, got %d fetches", n)
+	}
+
+	w = httptest.NewRecorder()
+	quitSrv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/refresh-models", nil).WithContext(ctx))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d for GET, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestDebugRefreshModelsOnlyWhenEnabled(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	for _, cfg := range []*Config{
+		{QuitPort: findAvailablePort(t), Debug: false, ModelsCacheTTLSec: 60},
+		{QuitPort: findAvailablePort(t), Debug: true},
+	} {
+		var closeOnce sync.Once
+		_, quitSrv := setupServers(ctx, cfg, newHandler(cfg), make(chan struct{}), &closeOnce)
+
+		w := httptest.NewRecorder()
+		quitSrv.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/debug/refresh-models", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d with debug=%v and cache TTL %d, got %d", http.StatusNotFound, cfg.Debug, cfg.ModelsCacheTTLSec, w.Code)
+		}
+	}
+}
+
+func TestModelsEmptyListing(t *testing.T) {
+	for _, body := range []string{`[]`, `null`, ``, `{"data": null}`} {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}))
+		for _, ttl := range []int{0, 60} {
+			got := getModels(t, newHandler(&Config{OpenWebUIURL: upstream.URL, ModelsCacheTTLSec: ttl}))
+			var list struct {
+				Object string            `json:"object"`
+				Data   []json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(got), &list); err != nil {
+				t.Fatalf("Failed to decode models listing for upstream body %q: %v", body, err)
+			}
+			if list.Object != "list" || list.Data == nil || len(list.Data) != 0 {
+				t.Errorf("Expected an empty list for upstream body %q with cache TTL %d, got %s", body, ttl, got)
+			}
+		}
+		upstream.Close()
+	}
+}
+
+func TestNormalizeModelsList(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`[{"id": "a"}]`, `{"data":[{"id":"a"}],"object":"list"}`},
+		{`{"data": [{"id": "a"}]}`, `{"data": [{"id": "a"}]}`},
+		{`{"object": "list"}`, `{"data":[],"object":"list"}`},
+		{`not json`, `not json`},
+	}
+	for _, tt := range tests {
+		if got := string(normalizeModelsList([]byte(tt.body))); got != tt.want {
+			t.Errorf("normalizeModelsList(%q) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
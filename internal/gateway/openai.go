@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
-	"sync"
+	"unicode/utf8"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
@@ -27,20 +33,226 @@ var (
 	defaultQuitPort int = 8081
 	// defaultShutdownTimeoutSec is the default timeout for graceful shutdown.
 	defaultShutdownTimeoutSec int = 15
+	// defaultShutdownProgressIntervalSec is the default interval of the shutdown progress logs.
+	defaultShutdownProgressIntervalSec int = 5
+	// defaultMaxBodyBytes is the default maximum size of a request body.
+	defaultMaxBodyBytes int64 = 10 * 1024 * 1024
+	// defaultDialTimeoutSec is the default timeout for connecting to Open-WebUI.
+	defaultDialTimeoutSec int = 10
+	// defaultRetryBackoffMs is the default delay before the first upstream retry.
+	defaultRetryBackoffMs int = 200
+	// defaultHighPriorityFraction is the default share of slots high priority requests may jump the queue for.
+	defaultHighPriorityFraction float64 = 0.5
+	// defaultMaxJSONDepth is the default maximum nesting depth of a chat request body.
+	defaultMaxJSONDepth int = 64
+	// defaultUpstreamKeepAliveSec is the default TCP keep-alive period of upstream connections.
+	defaultUpstreamKeepAliveSec int = 30
+	// defaultUpstreamIdleConnTimeoutSec is the default time an idle upstream connection is kept for reuse.
+	defaultUpstreamIdleConnTimeoutSec int = 90
+	// defaultRequestTransformTimeoutSec is the default time limit of a request transform command.
+	defaultRequestTransformTimeoutSec int = 5
+	// defaultMaxHeaderBytes is the default maximum size of the request headers.
+	defaultMaxHeaderBytes int = 64 * 1024
+	// defaultNConcurrency is the default number of concurrent upstream calls of an n>1 chat request.
+	defaultNConcurrency int = 4
+	// defaultMaxPathLength is the default maximum length of a forwarded path.
+	defaultMaxPathLength int = 2048
+	// defaultContentType is the default Content-Type for forwarded JSON responses that lack one.
+	defaultContentType string = "application/json"
 )
 
+// chatIDHeader carries the Open-WebUI conversation ID between client and gateway.
+const chatIDHeader = "X-Chat-Id"
+
+// pipelineIDHeader selects the Open-WebUI pipeline or function a chat request is
+// routed through, overriding the request body and Config.DefaultPipeline.
+const pipelineIDHeader = "X-Pipeline-Id"
+
+// jsonEndpoints lists the forwarded upstream paths that always respond with JSON.
+var jsonEndpoints = map[string]bool{
+	"/models":      true,
+	"/completions": true,
+	"/embeddings":  true,
+	"/moderations": true,
+}
+
+// allowedMethods lists the methods accepted by the main API routes.
+const allowedMethods = "GET, POST, OPTIONS"
+
+// allowedMethodsWithHead is allowedMethods with Config.ForwardHead.
+const allowedMethodsWithHead = "GET, HEAD, POST, OPTIONS"
+
 // Config holds the application configuration, excluding the logger.
 type Config struct {
-	Port int
-	OpenWebUIURL string
-	QuitPort int
-	ShutdownTimeoutSec int
+	Port                   int
+	OpenWebUIURL           string
+	QuitPort               int
+	ShutdownTimeoutSec     int
+	TimingHeaders          bool
+	MaxConcurrency         int
+	FairQueue              bool
+	DefaultModel           string
+	MaxBodyBytes           int64
+	DialTimeoutSec         int
+	Metrics                bool
+	RequestTimeoutSec      int
+	MaxRetries             int
+	RetryBackoffMs         int
+	OpenWebUIAPIKey        string
+	Debug                  bool
+	ResponseHeaders        map[string]string
+	WriteTimeoutSec        int
+	UpstreamResponseFormat string
+	HighPriorityFraction   float64
+	DefaultContentType     string
+	MaxPromptChars         int
+	UpstreamProxy          string
+	ModelsCacheTTLSec      int
+	FollowRedirects        bool
+	QuitSocket             string
+	AllowedModels          []string
+	MaxJSONDepth           int
+	DisableQuitServer      bool
+	SlowRequestThresholdMs int
+	// MaxConnRetries and MaxStatusRetries limit retries after connection
+	// errors and after retryable status codes respectively; 0 uses MaxRetries.
+	MaxConnRetries   int
+	MaxStatusRetries int
+	// AuditFile receives one JSON line per chat completion; empty disables auditing.
+	AuditFile string
+	// DefaultPipeline is the Open-WebUI pipeline used when a request selects none.
+	DefaultPipeline string
+	// NConcurrency limits how many upstream calls of an n>1 request run at once; 0 runs all n together.
+	NConcurrency int
+	// TrustedProxies lists the IP addresses and CIDR ranges whose requests may
+	// ask for verbose logging via debugHeader and whose X-Forwarded-For header
+	// identifies the client, see forwardedClientIP.
+	TrustedProxies []string
+	// UpstreamKeepAliveSec is the TCP keep-alive period of upstream connections;
+	// 0 uses defaultUpstreamKeepAliveSec and a negative value disables probes.
+	UpstreamKeepAliveSec int
+	// UpstreamDisableKeepAlive opens a new upstream connection for every request.
+	UpstreamDisableKeepAlive bool
+	// StatusRemap rewrites outgoing response status codes, see withStatusRemap.
+	StatusRemap map[int]int
+	// StreamKeepAliveSec is the interval of keepalive comments on chat streams; 0 disables them.
+	StreamKeepAliveSec int
+	// RequestTransformCmd is a shell command that rewrites chat request bodies
+	// from stdin to stdout before they are validated and forwarded.
+	RequestTransformCmd        string
+	RequestTransformTimeoutSec int
+	// ShutdownWebhook receives a JSON shutdownEvent once the servers have stopped.
+	ShutdownWebhook string
+	// ForwardOrgHeaders forwards OpenAI-Organization and OpenAI-Project to Open-WebUI instead of stripping them.
+	ForwardOrgHeaders bool
+	// MaxStreamingConnections limits concurrently active chat streams; 0 means unlimited.
+	MaxStreamingConnections int
+	// EchoRequest returns a content-free summary of each parsed chat request in requestEchoHeader.
+	EchoRequest bool
+	// EndpointConcurrency limits concurrent requests per request path, see withEndpointLimit.
+	EndpointConcurrency map[string]int
+	// UpstreamMaxIdleConnsPerHost is the number of idle upstream connections kept
+	// for reuse; 0 uses the Go default of 2.
+	UpstreamMaxIdleConnsPerHost int
+	// UpstreamIdleConnTimeoutSec closes idle upstream connections after this many
+	// seconds. It should be below the keep-alive timeout of Open-WebUI so that the
+	// gateway never reuses a connection the upstream is about to close.
+	UpstreamIdleConnTimeoutSec int
+	// MaxHeaderBytes bounds the size of request headers; larger requests are
+	// answered with 431 Request Header Fields Too Large.
+	MaxHeaderBytes int
+	// CoalesceRequests lets concurrent buffered chat completions with the same
+	// idempotencyKeyHeader share a single upstream call, see coalescer.
+	CoalesceRequests bool
+	// MaxStreamDurationSec caps how long a single chat stream may run; 0 means unlimited.
+	MaxStreamDurationSec int
+	// TaskRoutes maps chat models to Open-WebUI task endpoints, see chatTargetPath.
+	TaskRoutes map[string]string
+	// NormalizeAssistantRole reports every response message with the assistant
+	// role, whatever role Open-WebUI returned.
+	NormalizeAssistantRole bool
+	// MaxConnsPerIP limits the concurrent requests of a single client IP, as
+	// seen through Config.TrustedProxies; 0 means unlimited.
+	MaxConnsPerIP int
+	// SystemFingerprint is reported in chat responses unless the upstream reports its own.
+	SystemFingerprint string
+	// RetryOnEarlyClose retries chat completions whose connection the upstream
+	// closed before responding, see isEarlyClose. The upstream may already have
+	// started generating, so this can duplicate work.
+	RetryOnEarlyClose bool
+	// Quiet moves the routine per-request Info logs of the main server to V(1),
+	// see accessLog, keeping warnings and errors, for deployments that collect
+	// access logs elsewhere.
+	Quiet bool
+	// HealthMethod is the HTTP method of the upstream health probe, see
+	// healthMethod; GET when empty.
+	HealthMethod string
+	// DedupWindowSec keeps the response of a buffered chat completion for this
+	// long and answers identical requests from it, see coalesceKey; 0 disables
+	// the window.
+	DedupWindowSec int
+	// BlockedPatterns are regular expressions matched against the text content
+	// of chat messages; a matching request is rejected before it is forwarded.
+	BlockedPatterns []string
+	// UsageHeaders reports the token usage of buffered chat completions as
+	// response headers as well, see setUsageHeaders.
+	UsageHeaders bool
+	// EnableAnthropic serves the Anthropic Messages API on anthropicMessagesPath,
+	// see handleAnthropicMessages.
+	EnableAnthropic bool
+	// ShutdownProgressIntervalSec is the interval at which a graceful shutdown
+	// logs the number of in-flight requests; 0 disables the progress logs.
+	ShutdownProgressIntervalSec int
+	// MaxPathLength bounds the length of paths forwarded to Open-WebUI by
+	// forwardAndTransform; longer ones are answered with 414. 0 means unlimited.
+	MaxPathLength int
+	// ForwardHead passes HEAD requests through to Open-WebUI, answering them with
+	// the upstream status and headers but no body. Without it HEAD gets 405.
+	ForwardHead bool
 }
 
 // OpenAI Compatible Request Structure
 type OpenAIChatRequest struct {
-	Model    string        `json:"model"`
-	Messages []MessageItem `json:"messages"`
+	Model            string        `json:"model"`
+	Messages         []MessageItem `json:"messages"`
+	Stream           bool          `json:"stream,omitempty"`
+	FrequencyPenalty *float64      `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64      `json:"presence_penalty,omitempty"`
+	// MaxTokens is the legacy name of MaxCompletionTokens.
+	MaxTokens           *int `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+	// LogitBias is opaque to the gateway and forwarded unchanged.
+	LogitBias json.RawMessage `json:"logit_bias,omitempty"`
+	// ChatID identifies the Open-WebUI conversation, see chatIDHeader.
+	ChatID string `json:"chat_id,omitempty"`
+	// PipelineID selects an Open-WebUI pipeline, see pipelineIDHeader.
+	PipelineID string `json:"pipeline_id,omitempty"`
+	// Files and Collections attach Open-WebUI knowledge for RAG and are
+	// forwarded unchanged.
+	Files       json.RawMessage `json:"files,omitempty"`
+	Collections json.RawMessage `json:"collections,omitempty"`
+	// N is the number of choices to generate, see fetchChatChoices.
+	N *int `json:"n,omitempty"`
+	// Logprobs and TopLogprobs request token log probabilities.
+	Logprobs    *bool `json:"logprobs,omitempty"`
+	TopLogprobs *int  `json:"top_logprobs,omitempty"`
+	// ServiceTier selects the processing priority and is echoed in the response.
+	ServiceTier *string `json:"service_tier,omitempty"`
+	// Tools and ToolChoice declare the functions the model may call and are
+	// forwarded unchanged.
+	Tools      json.RawMessage `json:"tools,omitempty"`
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+	// ParallelToolCalls allows the model to request several tool calls in one
+	// turn. It is a pointer so that an explicit false is still forwarded.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// StreamOptions tune streaming responses and are forwarded unchanged.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// Store asks for the completion to be persisted, which Open-WebUI can do in
+	// its database. It is a pointer so that an explicit false is still forwarded.
+	Store *bool `json:"store,omitempty"`
+	// Metadata tags the request with key-value pairs. It is forwarded unchanged
+	// and only its keys are audited, see metadataKeys.
+	Metadata json.RawMessage `json:"metadata,omitempty"`
 }
 
 // OpenAI Compatible Response Structure
@@ -51,17 +263,93 @@ type OpenAIChatResponse struct {
 	Model   string     `json:"model"`
 	Choices []Choice   `json:"choices"`
 	Usage   TokenUsage `json:"usage"`
+	// ServiceTier echoes the service_tier of the request.
+	ServiceTier *string `json:"service_tier,omitempty"`
+	// SystemFingerprint identifies the backend configuration, see systemFingerprint.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
 }
 
+// MessageItem is a chat message. Its JSON encoding is handled in content.go so
+// that content can be either a string or an array of content parts.
 type MessageItem struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string
+	Content string
+	// Parts holds multimodal content parts; Content then holds their text.
+	Parts     []ContentPart
+	ToolCalls []ToolCall
+	// ToolCallID links a tool message to the tool call it answers.
+	ToolCallID string
+}
+
+// isEmpty reports whether the message carries neither a role, content nor tool calls.
+func (m MessageItem) isEmpty() bool {
+	return m.Role == "" && m.Content == "" && len(m.Parts) == 0 && len(m.ToolCalls) == 0
+}
+
+// promptChars returns the total number of characters across all message contents.
+func promptChars(messages []MessageItem) int {
+	n := 0
+	for _, m := range messages {
+		n += utf8.RuneCountInString(m.Content)
+	}
+	return n
+}
+
+// finishReason returns the OpenAI finish_reason for a completed message.
+func (m MessageItem) finishReason() string {
+	if len(m.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// ToolCall is a function call requested by the model. Index is only set on
+// streamed deltas, where it ties argument fragments to their call.
+type ToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// UnmarshalJSON accepts arguments both as an OpenAI-style JSON string and as
+// the JSON object sent by Ollama, which is kept in its encoded form.
+func (f *ToolCallFunction) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Name = raw.Name
+	f.Arguments = ""
+	args := bytes.TrimSpace(raw.Arguments)
+	switch {
+	case len(args) == 0 || string(args) == "null":
+	case args[0] == '"':
+		return json.Unmarshal(args, &f.Arguments)
+	default:
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, args); err != nil {
+			return err
+		}
+		f.Arguments = compact.String()
+	}
+	return nil
 }
 
 type Choice struct {
-	Index        int         `json:"index"`
-	Message      MessageItem `json:"message"`
-	FinishReason string      `json:"finish_reason"`
+	Index   int         `json:"index"`
+	Message MessageItem `json:"message"`
+	// Logprobs is relayed from the upstream response unchanged.
+	Logprobs     json.RawMessage `json:"logprobs,omitempty"`
+	FinishReason string          `json:"finish_reason"`
 }
 
 type TokenUsage struct {
@@ -70,10 +358,50 @@ type TokenUsage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// OpenAI Compatible Error Structure
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// writeOpenAIError writes an OpenAI-style JSON error response.
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OpenAIErrorResponse{Error: OpenAIError{Message: message, Type: errType, Code: code}})
+}
+
 // Open-WebUI Response Structure
 type OpenWebUIChatResponse struct {
 	Message MessageItem `json:"message"`
 	Status  string      `json:"status"`
+	Usage   *TokenUsage `json:"usage,omitempty"`
+	// Logprobs holds token log probabilities when the upstream reports them.
+	Logprobs json.RawMessage `json:"logprobs,omitempty"`
+	// SystemFingerprint is set by upstreams that report one.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	// PromptEvalCount and EvalCount are Ollama-style token counts.
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+// tokenUsage returns the token usage reported by Open-WebUI, preferring an
+// OpenAI-style usage object over Ollama-style counts.
+func (r OpenWebUIChatResponse) tokenUsage() TokenUsage {
+	if r.Usage != nil {
+		return *r.Usage
+	}
+	return TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
 }
 
 type OpenWebUIModel struct {
@@ -85,6 +413,56 @@ type OpenWebUIModel struct {
 type handler struct {
 	// Config holds the application configuration.
 	Config *Config
+	// scheduler limits concurrent upstream requests; nil when unlimited.
+	scheduler *scheduler
+	// client is the shared upstream client, see upstreamClient.
+	client     *http.Client
+	clientOnce sync.Once
+	// metrics holds the Prometheus collectors; nil when metrics are disabled.
+	metrics *metrics
+	// models caches the upstream models listing; nil when caching is disabled.
+	models *modelsCache
+	// latencies holds recent upstream latencies for /debug/stats; nil unless debugging.
+	latencies *latencyWindow
+	// audit receives chat completion audit records; nil when auditing is disabled.
+	audit *auditLog
+	// maintenance is set while maintenance mode is enabled, see withMaintenance.
+	maintenance atomic.Bool
+	// served counts the API requests handled, for the shutdown webhook.
+	served atomic.Int64
+	// inFlight counts the main server requests being handled, see countInFlight.
+	inFlight atomic.Int64
+	// streams counts the active chat streams, see acquireStream.
+	streams atomic.Int64
+	// blocked holds the compiled Config.BlockedPatterns.
+	blocked []*regexp.Regexp
+	// endpoints holds the semaphores of Config.EndpointConcurrency by path.
+	endpoints map[string]chan struct{}
+	// coalescer shares chat completions between duplicate requests, see
+	// coalesceKey; nil unless Config.CoalesceRequests or Config.DedupWindowSec.
+	coalescer *coalescer
+}
+
+// newHandler creates a handler and the shared state derived from cfg.
+func newHandler(cfg *Config) *handler {
+	h := &handler{Config: cfg, endpoints: newEndpointLimits(cfg.EndpointConcurrency)}
+	if cfg.MaxConcurrency > 0 {
+		h.scheduler = newScheduler(cfg.MaxConcurrency, cfg.FairQueue, cfg.HighPriorityFraction)
+	}
+	if cfg.Metrics {
+		h.metrics = newMetrics()
+	}
+	if cfg.Debug {
+		h.latencies = newLatencyWindow(latencyWindowSize)
+	}
+	h.blocked, _ = compileBlockedPatterns(cfg.BlockedPatterns)
+	if cfg.CoalesceRequests || cfg.DedupWindowSec > 0 {
+		h.coalescer = newCoalescer(time.Duration(cfg.DedupWindowSec) * time.Second)
+	}
+	if cfg.ModelsCacheTTLSec > 0 {
+		h.models = newModelsCache(time.Duration(cfg.ModelsCacheTTLSec) * time.Second)
+	}
+	return h
 }
 
 func NewServeCommand() *cobra.Command {
@@ -92,16 +470,156 @@ func NewServeCommand() *cobra.Command {
 	var openWebUIURL string
 	var quitPort int
 	var shutdownTimeoutSec int
+	var timingHeaders bool
+	var maxConcurrency int
+	var fairQueue bool
+	var defaultModel string
+	var maxBodyBytes int64
+	var dialTimeoutSec int
+	var enableMetrics bool
+	var requestTimeoutSec int
+	var maxRetries int
+	var retryBackoffMs int
+	var openWebUIAPIKey string
+	var debug bool
+	var responseHeaders []string
+	var writeTimeoutSec int
+	var upstreamResponseFormat string
+	var highPriorityFraction float64
+	var defaultContentTypeValue string
+	var maxPromptChars int
+	var upstreamProxy string
+	var modelsCacheTTLSec int
+	var followRedirects bool
+	var quitSocket string
+	var allowedModels []string
+	var maxJSONDepth int
+	var disableQuitServer bool
+	var slowRequestThresholdMs int
+	var maxConnRetries int
+	var maxStatusRetries int
+	var auditFile string
+	var defaultPipeline string
+	var nConcurrency int
+	var trustedProxies []string
+	var upstreamKeepAliveSec int
+	var upstreamDisableKeepAlive bool
+	var statusRemap []string
+	var streamKeepAliveSec int
+	var requestTransformCmd string
+	var requestTransformTimeoutSec int
+	var shutdownWebhook string
+	var forwardOrgHeaders bool
+	var maxStreamingConnections int
+	var echoRequestHeader bool
+	var endpointConcurrency []string
+	var upstreamMaxIdleConnsPerHost int
+	var upstreamIdleConnTimeoutSec int
+	var maxHeaderBytes int
+	var coalesceRequests bool
+	var maxStreamDurationSec int
+	var taskRoutes []string
+	var normalizeAssistantRole bool
+	var maxConnsPerIP int
+	var systemFingerprint string
+	var retryOnEarlyClose bool
+	var quiet bool
+	var healthMethod string
+	var dedupWindowSec int
+	var blockedPatterns []string
+	var usageHeaders bool
+	var enableAnthropic bool
+	var shutdownProgressIntervalSec int
+	var maxPathLength int
+	var forwardHead bool
 
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Starts the OpenAI compatible gateway server",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			headers, err := parseResponseHeaders(responseHeaders)
+			if err != nil {
+				return err
+			}
+			remap, err := parseStatusRemap(statusRemap)
+			if err != nil {
+				return err
+			}
+			endpointLimits, err := parseEndpointConcurrency(endpointConcurrency)
+			if err != nil {
+				return err
+			}
+			routes, err := parseTaskRoutes(taskRoutes)
+			if err != nil {
+				return err
+			}
 			cfg := &Config{
-				Port:               port,
-				OpenWebUIURL:       openWebUIURL,
-				QuitPort:           quitPort,
-				ShutdownTimeoutSec: shutdownTimeoutSec,
+				Port:                        port,
+				OpenWebUIURL:                openWebUIURL,
+				QuitPort:                    quitPort,
+				ShutdownTimeoutSec:          shutdownTimeoutSec,
+				TimingHeaders:               timingHeaders,
+				MaxConcurrency:              maxConcurrency,
+				FairQueue:                   fairQueue,
+				DefaultModel:                defaultModel,
+				MaxBodyBytes:                maxBodyBytes,
+				DialTimeoutSec:              dialTimeoutSec,
+				Metrics:                     enableMetrics,
+				RequestTimeoutSec:           requestTimeoutSec,
+				MaxRetries:                  maxRetries,
+				RetryBackoffMs:              retryBackoffMs,
+				OpenWebUIAPIKey:             openWebUIAPIKey,
+				Debug:                       debug,
+				ResponseHeaders:             headers,
+				WriteTimeoutSec:             writeTimeoutSec,
+				UpstreamResponseFormat:      upstreamResponseFormat,
+				HighPriorityFraction:        highPriorityFraction,
+				DefaultContentType:          defaultContentTypeValue,
+				MaxPromptChars:              maxPromptChars,
+				UpstreamProxy:               upstreamProxy,
+				ModelsCacheTTLSec:           modelsCacheTTLSec,
+				FollowRedirects:             followRedirects,
+				QuitSocket:                  quitSocket,
+				AllowedModels:               allowedModels,
+				MaxJSONDepth:                maxJSONDepth,
+				DisableQuitServer:           disableQuitServer,
+				SlowRequestThresholdMs:      slowRequestThresholdMs,
+				MaxConnRetries:              maxConnRetries,
+				MaxStatusRetries:            maxStatusRetries,
+				AuditFile:                   auditFile,
+				DefaultPipeline:             defaultPipeline,
+				NConcurrency:                nConcurrency,
+				TrustedProxies:              trustedProxies,
+				UpstreamKeepAliveSec:        upstreamKeepAliveSec,
+				UpstreamDisableKeepAlive:    upstreamDisableKeepAlive,
+				StatusRemap:                 remap,
+				StreamKeepAliveSec:          streamKeepAliveSec,
+				RequestTransformCmd:         requestTransformCmd,
+				RequestTransformTimeoutSec:  requestTransformTimeoutSec,
+				ShutdownWebhook:             shutdownWebhook,
+				ForwardOrgHeaders:           forwardOrgHeaders,
+				MaxStreamingConnections:     maxStreamingConnections,
+				EchoRequest:                 echoRequestHeader,
+				EndpointConcurrency:         endpointLimits,
+				UpstreamMaxIdleConnsPerHost: upstreamMaxIdleConnsPerHost,
+				UpstreamIdleConnTimeoutSec:  upstreamIdleConnTimeoutSec,
+				MaxHeaderBytes:              maxHeaderBytes,
+				CoalesceRequests:            coalesceRequests,
+				MaxStreamDurationSec:        maxStreamDurationSec,
+				TaskRoutes:                  routes,
+				NormalizeAssistantRole:      normalizeAssistantRole,
+				MaxConnsPerIP:               maxConnsPerIP,
+				SystemFingerprint:           systemFingerprint,
+				RetryOnEarlyClose:           retryOnEarlyClose,
+				Quiet:                       quiet,
+				HealthMethod:                healthMethod,
+				DedupWindowSec:              dedupWindowSec,
+				BlockedPatterns:             blockedPatterns,
+				UsageHeaders:                usageHeaders,
+				EnableAnthropic:             enableAnthropic,
+				ShutdownProgressIntervalSec: shutdownProgressIntervalSec,
+				MaxPathLength:               maxPathLength,
+				ForwardHead:                 forwardHead,
 			}
 			return processServe(cmd.Context(), cfg)
 		},
@@ -111,9 +629,70 @@ func NewServeCommand() *cobra.Command {
 	cmd.Flags().StringVar(&openWebUIURL, "open-webui-url", os.Getenv("OPEN_WEBUI_URL"), "Open-WebUI API endpoint URL (can also be set via OPEN_WEBUI_URL env var)")
 	cmd.Flags().IntVar(&quitPort, "quit-port", defaultQuitPort, "Internal port for the quit signal server")
 	cmd.Flags().IntVar(&shutdownTimeoutSec, "shutdown-timeout", defaultShutdownTimeoutSec, "Timeout for graceful shutdown in seconds")
+	cmd.Flags().BoolVar(&timingHeaders, "timing-headers", false, "Include X-Upstream-Duration-Ms and X-Gateway-Duration-Ms headers on chat completion responses")
+	cmd.Flags().IntVar(&maxConcurrency, "max-concurrency", 0, "Maximum number of concurrent upstream requests (0 means unlimited)")
+	cmd.Flags().BoolVar(&fairQueue, "fair-queue", false, "Schedule queued requests round-robin across clients when --max-concurrency is set")
+	cmd.Flags().StringVar(&defaultModel, "default-model", "", "Model used for chat requests that omit the model field")
+	cmd.Flags().Int64Var(&maxBodyBytes, "max-body-bytes", defaultMaxBodyBytes, "Maximum request body size in bytes (0 means unlimited)")
+	cmd.Flags().IntVar(&dialTimeoutSec, "dial-timeout", defaultDialTimeoutSec, "Timeout for connecting to Open-WebUI in seconds (0 uses the OS default)")
+	cmd.Flags().BoolVar(&enableMetrics, "metrics", false, "Expose Prometheus metrics on /metrics")
+	cmd.Flags().IntVar(&requestTimeoutSec, "request-timeout", 0, "Timeout in seconds for a buffered upstream request, shared by all retries (0 means no timeout)")
+	cmd.Flags().IntVar(&maxRetries, "max-retries", 0, "Maximum number of retries for transient upstream failures; POST requests are only retried if they never reached Open-WebUI")
+	cmd.Flags().IntVar(&retryBackoffMs, "retry-backoff-ms", defaultRetryBackoffMs, "Delay in milliseconds before the first retry, doubled for each further retry up to 30s")
+	cmd.Flags().StringVar(&openWebUIAPIKey, "open-webui-api-key", os.Getenv("OPEN_WEBUI_API_KEY"), "API key sent to Open-WebUI when the client provides no Authorization header (can also be set via OPEN_WEBUI_API_KEY env var)")
+	cmd.Flags().BoolVar(&debug, "debug", false, "Enable debug endpoints on the internal quit server")
+	cmd.Flags().StringArrayVar(&responseHeaders, "response-header", nil, "Static header added to every response as \"Name: value\" (repeatable)")
+	cmd.Flags().IntVar(&writeTimeoutSec, "write-timeout", 0, "Timeout in seconds for writing a buffered response; streams extend it per event (0 means no timeout)")
+	cmd.Flags().StringVar(&upstreamResponseFormat, "upstream-response-format", upstreamFormatAuto, "Shape of upstream chat responses: auto, openwebui, ollama or openai")
+	cmd.Flags().Float64Var(&highPriorityFraction, "high-priority-fraction", defaultHighPriorityFraction, "Fraction of --max-concurrency slots that requests with X-Priority: high may jump the queue for")
+	cmd.Flags().StringVar(&defaultContentTypeValue, "default-content-type", defaultContentType, "Content-Type set on forwarded JSON endpoint responses when Open-WebUI omits it (empty disables)")
+	cmd.Flags().IntVar(&maxPromptChars, "max-prompt-chars", 0, "Maximum total characters across all chat message contents (0 means unlimited)")
+	cmd.Flags().StringVar(&upstreamProxy, "upstream-proxy", "", "HTTP proxy URL for requests to Open-WebUI, overriding HTTP_PROXY/HTTPS_PROXY")
+	cmd.Flags().IntVar(&modelsCacheTTLSec, "models-cache-ttl", 0, "Seconds to cache the upstream models listing of each client credential (0 disables caching)")
+	cmd.Flags().BoolVar(&followRedirects, "follow-redirects", false, "Follow upstream redirects to the same host, keeping the Authorization header; other redirects are returned as is")
+	cmd.Flags().StringVar(&quitSocket, "quit-socket", "", "Unix domain socket path for the quit server, used instead of --quit-port")
+	cmd.Flags().StringSliceVar(&allowedModels, "allowed-models", nil, "Comma-separated models chat requests may use, applied after the default model (empty allows all)")
+	cmd.Flags().IntVar(&maxJSONDepth, "max-json-depth", defaultMaxJSONDepth, "Maximum nesting depth of objects and arrays in a chat request body (0 means unlimited)")
+	cmd.Flags().BoolVar(&disableQuitServer, "disable-quit-server", false, "Do not start the internal quit server; shut down on SIGINT/SIGTERM only (also disables debug endpoints)")
+	cmd.Flags().IntVar(&slowRequestThresholdMs, "slow-request-threshold-ms", 0, "Log a warning for requests taking longer than this many milliseconds (0 disables)")
+	cmd.Flags().IntVar(&maxConnRetries, "max-conn-retries", 0, "Maximum number of retries after upstream connection errors (0 uses --max-retries)")
+	cmd.Flags().IntVar(&maxStatusRetries, "max-status-retries", 0, "Maximum number of retries after 502, 503 or 504 upstream responses (0 uses --max-retries)")
+	cmd.Flags().StringVar(&auditFile, "audit-file", "", "Append a JSON line per chat completion with model, message count, usage, status and duration, but no message content")
+	cmd.Flags().StringVar(&defaultPipeline, "default-pipeline", "", "Open-WebUI pipeline ID used for chat requests that select none via X-Pipeline-Id or pipeline_id")
+	cmd.Flags().IntVar(&nConcurrency, "n-concurrency", defaultNConcurrency, "Maximum number of concurrent upstream calls for a chat request with n > 1, each beyond the first taking a free --max-concurrency slot (0 runs all n concurrently)")
+	cmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxies", nil, "Comma-separated IP addresses or CIDR ranges whose requests may enable verbose logging with an X-Debug: true header and whose X-Forwarded-For is trusted")
+	cmd.Flags().IntVar(&upstreamKeepAliveSec, "upstream-keepalive", defaultUpstreamKeepAliveSec, "TCP keep-alive period in seconds for upstream connections (negative disables keep-alive probes)")
+	cmd.Flags().BoolVar(&upstreamDisableKeepAlive, "upstream-disable-keepalive", false, "Do not reuse upstream connections; open a new connection for every request to Open-WebUI")
+	cmd.Flags().StringArrayVar(&statusRemap, "status-remap", nil, "Rewrite an outgoing response status as \"from=>to\", e.g. 502=>503 (repeatable)")
+	cmd.Flags().IntVar(&streamKeepAliveSec, "stream-keepalive", 0, "Interval in seconds of keepalive comments sent on idle chat streams (0 disables)")
+	cmd.Flags().StringVar(&requestTransformCmd, "request-transform-cmd", "", "Shell command that receives each chat request body on stdin and prints the body to forward on stdout")
+	cmd.Flags().IntVar(&requestTransformTimeoutSec, "request-transform-timeout", defaultRequestTransformTimeoutSec, "Time limit in seconds for --request-transform-cmd")
+	cmd.Flags().StringVar(&shutdownWebhook, "shutdown-webhook", "", "URL that receives a JSON POST with the reason, uptime and requests served when the gateway shuts down")
+	cmd.Flags().BoolVar(&forwardOrgHeaders, "forward-org-headers", false, "Forward OpenAI-Organization and OpenAI-Project headers to Open-WebUI instead of stripping them")
+	cmd.Flags().IntVar(&maxStreamingConnections, "max-streaming-connections", 0, "Maximum number of concurrent chat streams; further streaming requests get a 503 (0 means unlimited)")
+	cmd.Flags().BoolVar(&echoRequestHeader, "echo-request", false, "Debug option: report the parsed chat request (model, message roles, parameters; no content) in an X-Request-Echo response header")
+	cmd.Flags().StringArrayVar(&endpointConcurrency, "endpoint-concurrency", nil, "Limit concurrent requests to a path as \"path=limit\", e.g. /v1/chat/completions=10; further requests get a 503 (repeatable)")
+	cmd.Flags().IntVar(&upstreamMaxIdleConnsPerHost, "upstream-max-idle-conns", 0, "Maximum number of idle upstream connections kept for reuse (0 uses the Go default of 2)")
+	cmd.Flags().IntVar(&upstreamIdleConnTimeoutSec, "upstream-idle-timeout", defaultUpstreamIdleConnTimeoutSec, "Seconds an idle upstream connection is kept for reuse; keep it below the keep-alive timeout of Open-WebUI")
+	cmd.Flags().IntVar(&maxHeaderBytes, "max-header-bytes", defaultMaxHeaderBytes, "Maximum size of request headers in bytes; larger requests get a 431 (0 uses the Go default of 1MB)")
+	cmd.Flags().BoolVar(&coalesceRequests, "coalesce-requests", false, "Let concurrent non-streaming chat completions with the same Idempotency-Key header share a single upstream call and response")
+	cmd.Flags().IntVar(&maxStreamDurationSec, "max-stream-duration", 0, "Maximum duration of a chat stream in seconds, after which it is closed with an error event (0 means unlimited)")
+	cmd.Flags().StringArrayVar(&taskRoutes, "task-route", nil, "Send chat completions for a model to an Open-WebUI task endpoint as \"model=path\", e.g. title-generator=/v1/tasks/title/completions (repeatable)")
+	cmd.Flags().BoolVar(&normalizeAssistantRole, "normalize-assistant-role", false, "Report every response message with the assistant role, whatever role Open-WebUI returned")
+	cmd.Flags().IntVar(&maxConnsPerIP, "max-conns-per-ip", 0, "Maximum number of concurrent requests per client IP, honoring X-Forwarded-For from --trusted-proxies; further requests get a 429 (0 means unlimited)")
+	cmd.Flags().StringVar(&systemFingerprint, "system-fingerprint", "", "system_fingerprint reported in chat responses when Open-WebUI reports none, e.g. the gateway or model version")
+	cmd.Flags().BoolVar(&retryOnEarlyClose, "retry-early-close", false, "Also retry chat completions when Open-WebUI closes the connection before responding; may duplicate generation work")
+	cmd.Flags().BoolVar(&quiet, "quiet", false, "Suppress routine per-request info logs, keeping warnings and errors")
+	cmd.Flags().StringVar(&healthMethod, "health-method", http.MethodGet, "HTTP method of the Open-WebUI health probe: GET, HEAD, POST or OPTIONS")
+	cmd.Flags().IntVar(&dedupWindowSec, "dedup-window", 0, "Answer identical buffered chat completions within this many seconds with the first response, for clients that retry rapidly (0 disables)")
+	cmd.Flags().StringArrayVar(&blockedPatterns, "blocked-pattern", nil, "Reject chat completions whose message content matches this regular expression, e.g. (?i)secret project (repeatable)")
+	cmd.Flags().BoolVar(&usageHeaders, "usage-headers", false, "Include X-Usage-Prompt-Tokens, X-Usage-Completion-Tokens and X-Usage-Total-Tokens headers on buffered chat completion responses")
+	cmd.Flags().BoolVar(&enableAnthropic, "enable-anthropic", false, "Serve the Anthropic Messages API on /v1/messages, translated to chat completions (streaming is not supported)")
+	cmd.Flags().IntVar(&shutdownProgressIntervalSec, "shutdown-progress-interval", defaultShutdownProgressIntervalSec, "Interval in seconds at which a graceful shutdown logs the remaining in-flight requests (0 disables)")
+	cmd.Flags().IntVar(&maxPathLength, "max-path-length", defaultMaxPathLength, "Maximum length of a path forwarded to Open-WebUI; longer ones get 414 URI Too Long (0 means unlimited)")
+	cmd.Flags().BoolVar(&forwardHead, "forward-head", true, "Forward HEAD requests to Open-WebUI, returning the upstream status and headers without a body (false answers them with 405)")
 	_ = cmd.MarkFlagRequired("open-webui-url")
 
-
 	return cmd
 }
 
@@ -125,10 +704,53 @@ func wrapLogger(log logr.Logger, next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// countInFlight is a middleware that counts the requests being handled, so that
+// a graceful shutdown can report how many remain, see logDrainProgress.
+func (h *handler) countInFlight(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.inFlight.Add(1)
+		defer h.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// allowedMethods returns the Allow header value of the main API routes.
+func (h *handler) allowedMethods() string {
+	if h.Config.ForwardHead {
+		return allowedMethodsWithHead
+	}
+	return allowedMethods
+}
+
+// handleOptions is a middleware that answers OPTIONS requests with the supported
+// methods before they reach the body limit, the concurrency limiter or handleRoot.
+func (h *handler) handleOptions(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", h.allowedMethods())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // handleQuitSignal handles the request to the internal quit endpoint.
-// It gets the logger from the request context.
+// It gets the logger from the request context. Only POST triggers the
+// shutdown, so that a misdirected GET, HEAD or OPTIONS probe cannot.
 func handleQuitSignal(stopChan chan<- struct{}, closeOnce *sync.Once) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+		case http.MethodOptions:
+			w.Header().Set("Allow", quitSignalMethods)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.Header().Set("Allow", quitSignalMethods)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 		log := logger.FromContext(r.Context())
 		log.Info("Received shutdown signal via /quitquitquit")
 		w.WriteHeader(http.StatusOK)
@@ -148,30 +770,64 @@ func runMainServer(ctx context.Context, cfg *Config, srv *http.Server, stopChan
 }
 
 // runQuitServer runs the internal quit server in a goroutine.
-func runQuitServer(ctx context.Context, srv *http.Server) {
+func runQuitServer(ctx context.Context, cfg *Config, srv *http.Server) {
 	log := logger.FromContext(ctx)
 	log.Info("Internal quit server starting", "address", srv.Addr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Error(err, "Quit server ListenAndServe error")
+	listener, err := listenQuit(cfg, srv.Addr)
+	if err != nil {
+		log.Error(err, "Quit server Listen error")
+		return
+	}
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Error(err, "Quit server Serve error")
 	}
 }
 
-// setupServers initializes the main API server and the internal quit server.
+// setupServers initializes the main API server and the internal quit server. The
+// quit server is nil when Config.DisableQuitServer is set.
 func setupServers(ctx context.Context, cfg *Config, h *handler, stopChan chan struct{}, closeOnce *sync.Once) (*http.Server, *http.Server) {
 	log := logger.FromContext(ctx)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	mainMux := http.NewServeMux()
-	mainMux.HandleFunc("/", wrapLogger(log, h.handleRoot))
-	mainMux.HandleFunc("/healthz", wrapLogger(log, h.handleHealth))
+	mainMux.HandleFunc("/", h.countInFlight(wrapLogger(log, h.withRoute(h.withDebugHeader(h.withSlowRequestLog(h.handleOptions(h.withMaintenance(h.withIPLimit(h.limitBody(h.withEndpointLimit(h.withConcurrencyLimit(h.handleRoot))))))))))))
+	mainMux.HandleFunc(healthPath, h.countInFlight(wrapLogger(log, h.withRoute(h.handleHealth))))
+	if h.metrics != nil {
+		mainMux.Handle("/metrics", h.metrics.handler())
+	}
 	mainSrv := &http.Server{
-		Addr:    addr,
-		Handler: mainMux,
+		Addr:         addr,
+		Handler:      h.withStatusRemap(h.withResponseHeaders(mainMux.ServeHTTP)),
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSec) * time.Second,
+		// Go answers requests over the limit with 431 on its own.
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+
+	if cfg.DisableQuitServer {
+		if cfg.Debug {
+			log.Info("Debug endpoints are unavailable because the quit server is disabled")
+		}
+		return mainSrv, nil
 	}
 
 	quitAddrStr := fmt.Sprintf("127.0.0.1:%d", cfg.QuitPort)
+	if cfg.QuitSocket != "" {
+		quitAddrStr = cfg.QuitSocket
+	}
 	quitMux := http.NewServeMux()
+	quitMux.HandleFunc("/", handleQuitRoot)
+	quitMux.HandleFunc(quitLivezPath, handleQuitLivez)
 	quitMux.HandleFunc("/quitquitquit", handleQuitSignal(stopChan, closeOnce))
+	quitMux.HandleFunc("/maintenance", wrapLogger(log, h.handleMaintenance))
+	if cfg.Debug {
+		quitMux.HandleFunc("/debug/config", wrapLogger(log, h.handleDebugConfig))
+		if h.latencies != nil {
+			quitMux.HandleFunc("/debug/stats", wrapLogger(log, h.handleDebugStats))
+		}
+		if h.models != nil {
+			quitMux.HandleFunc("/debug/refresh-models", wrapLogger(log, h.handleDebugRefreshModels))
+		}
+	}
 	quitSrv := &http.Server{
 		Addr:    quitAddrStr,
 		Handler: quitMux,
@@ -183,44 +839,89 @@ func setupServers(ctx context.Context, cfg *Config, h *handler, stopChan chan st
 // startServers starts the main and quit servers in separate goroutines.
 func startServers(ctx context.Context, cfg *Config, mainSrv, quitSrv *http.Server, stopChan chan struct{}, closeOnce *sync.Once) {
 	go runMainServer(ctx, cfg, mainSrv, stopChan, closeOnce)
-	go runQuitServer(ctx, quitSrv)
+	if quitSrv != nil {
+		go runQuitServer(ctx, cfg, quitSrv)
+	}
 }
 
 // waitForShutdownSignal blocks until a shutdown signal (OS or internal) is received.
-func waitForShutdownSignal(ctx context.Context, stopChan <-chan struct{}) {
-	log := logger.FromContext(ctx)
+func waitForShutdownSignal(ctx context.Context, stopChan <-chan struct{}) string {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	return waitForShutdown(ctx, sigChan, stopChan)
+}
 
+// waitForShutdown returns on the first of an OS signal on sigChan or the close
+// of stopChan, reporting the reason. If both arrive together either one may win;
+// the shutdown that follows is the same, and further triggers are ignored.
+func waitForShutdown(ctx context.Context, sigChan <-chan os.Signal, stopChan <-chan struct{}) string {
+	log := logger.FromContext(ctx)
 	select {
 	case sig := <-sigChan:
 		log.Info("Received OS signal, initiating shutdown", "signal", sig.String())
+		return "signal: " + sig.String()
 	case <-stopChan:
 		log.Info("Received internal signal, initiating shutdown")
+		return "quit endpoint"
 	}
 }
 
-// shutdownServers performs graceful shutdown of the main and quit servers.
-func shutdownServers(ctx context.Context, cfg *Config, mainSrv, quitSrv *http.Server) {
+// logDrainProgress logs the number of in-flight requests every interval until
+// the returned function is called, so that operators can follow a long drain.
+// A non-positive interval disables the logging.
+func (h *handler) logDrainProgress(ctx context.Context, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
 	log := logger.FromContext(ctx)
-	log.Info("Starting graceful shutdown...")
-	shutdownTimeout := time.Duration(cfg.ShutdownTimeoutSec) * time.Second
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-	defer cancel()
-
-	if err := mainSrv.Shutdown(shutdownCtx); err != nil {
-		log.Error(err, "Main server shutdown error")
-	} else {
-		log.Info("Main server gracefully stopped")
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Info("Draining in-flight requests", "in_flight", h.inFlight.Load())
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
 	}
+}
 
-	if err := quitSrv.Shutdown(shutdownCtx); err != nil {
-		log.Error(err, "Quit server shutdown error")
-	} else {
-		log.Info("Quit server gracefully stopped")
-	}
+// shutdownServers performs graceful shutdown of the main and quit servers. It
+// runs at most once per shutdownOnce; later calls return immediately.
+func shutdownServers(ctx context.Context, cfg *Config, mainSrv, quitSrv *http.Server, shutdownOnce *sync.Once) {
+	shutdownOnce.Do(func() {
+		log := logger.FromContext(ctx)
+		log.Info("Starting graceful shutdown...")
+		shutdownTimeout := time.Duration(cfg.ShutdownTimeoutSec) * time.Second
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := mainSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Main server shutdown error")
+		} else {
+			log.Info("Main server gracefully stopped")
+		}
 
-	log.Info("Graceful shutdown complete")
+		if quitSrv != nil {
+			if err := quitSrv.Shutdown(shutdownCtx); err != nil {
+				log.Error(err, "Quit server shutdown error")
+			} else {
+				log.Info("Quit server gracefully stopped")
+			}
+		}
+
+		log.Info("Graceful shutdown complete")
+	})
 }
 
 // processServe is the main execution function for the serve command.
@@ -231,211 +932,507 @@ func processServe(ctx context.Context, cfg *Config) error {
 		log.Error(fmt.Errorf("--open-webui-url is required"), "Startup error")
 		return fmt.Errorf("--open-webui-url is required")
 	}
+	if err := validateOpenWebUIURL(cfg.OpenWebUIURL); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if err := validateUpstreamFormat(cfg.UpstreamResponseFormat); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if err := validateUpstreamProxy(cfg.UpstreamProxy); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if err := validateShutdownWebhook(cfg.ShutdownWebhook); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if err := validateHealthMethod(cfg.HealthMethod); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if err := validateQuitPort(cfg); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	if _, err := compileBlockedPatterns(cfg.BlockedPatterns); err != nil {
+		log.Error(err, "Startup error")
+		return err
+	}
+	started := time.Now()
 
 	stopChan := make(chan struct{})
-	var closeOnce sync.Once
-
-	h := &handler{Config: cfg}
+	var closeOnce, shutdownOnce sync.Once
+
+	h := newHandler(cfg)
+	if cfg.AuditFile != "" {
+		audit, err := openAuditLog(cfg.AuditFile)
+		if err != nil {
+			log.Error(err, "Startup error")
+			return err
+		}
+		defer audit.Close()
+		h.audit = audit
+	}
 
 	mainSrv, quitSrv := setupServers(ctx, cfg, h, stopChan, &closeOnce)
 	startServers(ctx, cfg, mainSrv, quitSrv, stopChan, &closeOnce)
-	waitForShutdownSignal(ctx, stopChan)
-	shutdownServers(ctx, cfg, mainSrv, quitSrv)
+	reason := waitForShutdownSignal(ctx, stopChan)
+	stopProgress := h.logDrainProgress(ctx, time.Duration(cfg.ShutdownProgressIntervalSec)*time.Second)
+	shutdownServers(ctx, cfg, mainSrv, quitSrv, &shutdownOnce)
+	stopProgress()
+	if cfg.ShutdownWebhook != "" {
+		notifyShutdown(ctx, cfg.ShutdownWebhook, shutdownEvent{
+			Reason:         reason,
+			UptimeSec:      time.Since(started).Seconds(),
+			RequestsServed: h.served.Load(),
+		})
+	}
 
 	return nil
 }
 
 func (h *handler) handleRoot(w http.ResponseWriter, r *http.Request) {
 	log := logger.FromContext(r.Context()).WithValues("request_id", randomString(8))
-	log.Info("Received request", "method", r.Method, "path", r.URL.Path)
-	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+	h.accessLog(log).Info("Received request", "method", r.Method, "path", r.URL.Path)
+	h.served.Add(1)
+	route := h.routeFrom(r)
+	switch {
+	case route == routeMethodNotAllowed, route == routeOptions:
+		// OPTIONS requests are answered by handleOptions before reaching here.
 		log.Info("Method not allowed", "method", r.Method)
+		w.Header().Set("Allow", h.allowedMethods())
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	if r.URL.Path == "/v1/chat/completions" {
+	case route == routeServiceRoot:
+		handleServiceRoot(w, r)
+	case route == routeCapabilities:
+		h.handleCapabilities(w, r)
+	case route == routeChatCompletions:
 		h.handleChatCompletions(w, r)
-		return
+	case route == routeModels && h.models != nil:
+		h.handleModels(w, r)
+	case route == routeMessages && h.Config.EnableAnthropic:
+		h.handleAnthropicMessages(w, r)
+	default:
+		h.forwardAndTransform(w, r)
 	}
-
-	h.forwardAndTransform(w, r)
 }
 
 func (h *handler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
-	log := logger.FromContext(r.Context()).WithValues("request_id", randomString(8))
+	requestStart := time.Now()
+	requestID := randomString(8)
+	log := logger.FromContext(r.Context()).WithValues("request_id", requestID)
+	audit := &auditRecord{RequestID: requestID}
+	if h.audit != nil {
+		w = audit.track(w)
+		defer func() { h.audit.write(log, audit, requestStart) }()
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		if isClientAbort(r, err) {
+			log.Info("Client disconnected while sending the request body", "error", err.Error())
+			audit.Status = statusClientClosedRequest
+			return
+		}
 		log.Error(err, "Failed to read request body")
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyReadError(w, err)
 		return
 	}
 	defer r.Body.Close()
 
+	if h.Config.RequestTransformCmd != "" {
+		if body, err = h.transformRequest(r.Context(), body); err != nil {
+			log.Error(err, "Failed to transform request body")
+			http.Error(w, "Failed to transform request", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !utf8.Valid(body) {
+		log.Info("Rejected chat completion request with invalid UTF-8 body")
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_encoding", "Request body is not valid UTF-8")
+		return
+	}
+
+	if h.Config.MaxJSONDepth > 0 {
+		if err := checkJSONDepth(body, h.Config.MaxJSONDepth); err != nil {
+			log.Info("Rejected chat completion request with deeply nested JSON", "error", err.Error())
+			http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	var openaiReq OpenAIChatRequest
-	if err := json.Unmarshal(body, &openaiReq); err != nil {
+	if err := decodeJSONBody(body, &openaiReq); err != nil {
 		log.Error(err, "Invalid JSON format", "body", string(body))
+		if errors.Is(err, errTrailingData) {
+			http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
-	log.Info("Handling chat completion request", "model", openaiReq.Model, "messages_count", len(openaiReq.Messages))
-
-	webuiReqBody, err := json.Marshal(openaiReq)
-	if err != nil {
-		log.Error(err, "Failed to marshal WebUI request")
-		http.Error(w, "Failed to marshal WebUI request", http.StatusInternalServerError)
+	if openaiReq.Model == "" {
+		if h.Config.DefaultModel == "" {
+			log.Info("Rejected chat completion request without a model")
+			http.Error(w, "Missing required field: model", http.StatusBadRequest)
+			return
+		}
+		openaiReq.Model = h.Config.DefaultModel
+		log.V(1).Info("Applied default model", "model", openaiReq.Model)
+	}
+	requestInfoFrom(r.Context()).setModel(openaiReq.Model)
+	audit.Model, audit.MessageCount = openaiReq.Model, len(openaiReq.Messages)
+	audit.MetadataKeys = metadataKeys(openaiReq.Metadata)
+	if openaiReq.MaxCompletionTokens == nil && openaiReq.MaxTokens != nil {
+		// Map the legacy field forward for upstreams that only know the new one.
+		openaiReq.MaxCompletionTokens = openaiReq.MaxTokens
+	}
+	if len(h.Config.AllowedModels) > 0 && !slices.Contains(h.Config.AllowedModels, openaiReq.Model) {
+		log.Info("Rejected chat completion request for a model that is not allowed", "model", openaiReq.Model)
+		writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", "model_not_allowed",
+			fmt.Sprintf("The model %q is not allowed on this gateway", openaiReq.Model))
 		return
 	}
-
-	targetURL := h.Config.OpenWebUIURL + "/chat"
-	log.Info("Forwarding request to Open-WebUI", "url", targetURL)
-	req, err := http.NewRequest("POST", targetURL, bytes.NewReader(webuiReqBody))
-	if err != nil {
-		log.Error(err, "Failed to create request to WebUI")
-		http.Error(w, "Failed to create request to WebUI", http.StatusInternalServerError)
+	if err := validateContentParts(openaiReq.Messages); err != nil {
+		log.Info("Rejected chat completion request with invalid content", "error", err.Error())
+		http.Error(w, "Invalid message content: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if auth := r.Header.Get("Authorization"); auth != "" {
-		req.Header.Set("Authorization", auth)
+	if i, pattern := blockedContent(h.blocked, openaiReq.Messages); i >= 0 {
+		log.Info("Rejected chat completion request with blocked content", "message_index", i, "pattern", pattern)
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "content_filter",
+			"The request was rejected by the gateway content policy")
+		return
 	}
-
-	client := &http.Client{}
-	startTime := time.Now()
-	resp, err := client.Do(req)
-	duration := time.Since(startTime)
-	if err != nil {
-		log.Error(err, "Failed to contact Open-WebUI", "duration_ms", duration.Milliseconds())
-		http.Error(w, "Failed to contact Open-WebUI", http.StatusBadGateway)
+	if limit := h.Config.MaxPromptChars; limit > 0 {
+		if n := promptChars(openaiReq.Messages); n > limit {
+			log.Info("Rejected chat completion request exceeding the prompt limit", "prompt_chars", n, "max_prompt_chars", limit)
+			http.Error(w, fmt.Sprintf("Prompt too long: %d characters exceeds the limit of %d", n, limit), http.StatusBadRequest)
+			return
+		}
+	}
+	if chatID := r.Header.Get(chatIDHeader); chatID != "" {
+		openaiReq.ChatID = chatID
+	} else if openaiReq.ChatID == "" {
+		openaiReq.ChatID = uuid.NewString()
+	}
+	w.Header().Set(chatIDHeader, openaiReq.ChatID)
+	if pipelineID := r.Header.Get(pipelineIDHeader); pipelineID != "" {
+		openaiReq.PipelineID = pipelineID
+	} else if openaiReq.PipelineID == "" {
+		openaiReq.PipelineID = h.Config.DefaultPipeline
+	}
+	log = log.WithValues("chat_id", openaiReq.ChatID)
+	if !openaiReq.Stream && acceptsEventStream(r) {
+		openaiReq.Stream = true
+		log.V(1).Info("Streaming requested via Accept header")
+	}
+	audit.Stream = openaiReq.Stream
+	choices := 1
+	if openaiReq.N != nil {
+		choices = *openaiReq.N
+		// Open-WebUI returns a single message, so choices are fanned out instead.
+		openaiReq.N = nil
+	}
+	if choices < 1 || choices > maxChoices {
+		log.Info("Rejected chat completion request with an invalid n", "n", choices)
+		http.Error(w, fmt.Sprintf("Invalid n: must be between 1 and %d", maxChoices), http.StatusBadRequest)
 		return
 	}
-	defer resp.Body.Close()
-
-	log.Info("Received response from Open-WebUI", "status_code", resp.StatusCode, "duration_ms", duration.Milliseconds())
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Error(fmt.Errorf("Open-WebUI returned non-OK status"), "Upstream error", "status_code", resp.StatusCode, "response_body", string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Open-WebUI Error (%d): %s", resp.StatusCode, string(bodyBytes)), http.StatusBadGateway)
+	if choices > 1 && openaiReq.Stream {
+		log.Info("Rejected streaming chat completion request with n > 1", "n", choices)
+		http.Error(w, "n > 1 is not supported for streaming requests", http.StatusBadRequest)
 		return
 	}
+	if h.Config.EchoRequest {
+		w.Header().Set(requestEchoHeader, echoRequest(openaiReq, choices))
+	}
+	h.accessLog(log).Info("Handling chat completion request", "model", openaiReq.Model, "messages_count", len(openaiReq.Messages))
 
-	webuiRespBody, err := io.ReadAll(resp.Body)
+	webuiReqBody, err := json.Marshal(openaiReq)
 	if err != nil {
-		log.Error(err, "Failed to read WebUI response body")
-		http.Error(w, "Failed to read WebUI response", http.StatusInternalServerError)
+		log.Error(err, "Failed to marshal WebUI request")
+		http.Error(w, "Failed to marshal WebUI request", http.StatusInternalServerError)
 		return
 	}
 
-	var webuiResp OpenWebUIChatResponse
-	if err := json.Unmarshal(webuiRespBody, &webuiResp); err != nil {
-		log.Error(err, "Invalid WebUI response format", "response_body", string(webuiRespBody))
-		http.Error(w, "Invalid WebUI response format", http.StatusInternalServerError)
+	targetURL := h.Config.OpenWebUIURL + h.chatTargetPath(openaiReq.Model)
+	h.accessLog(log).Info("Forwarding request to Open-WebUI", "url", targetURL)
+	ctx, cancel := h.upstreamContext(logger.WithContext(r.Context(), log), openaiReq.Stream)
+	defer cancel()
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(webuiReqBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		h.setUpstreamAuth(req, r)
+		h.setOrgHeaders(req, r)
+		return req, nil
+	}
+
+	startTime := time.Now()
+	if openaiReq.Stream {
+		release, ok := h.acquireStream()
+		if !ok {
+			log.Info("Rejected streaming chat completion request over the streaming connection limit", "max_streaming_connections", h.Config.MaxStreamingConnections)
+			w.Header().Set(streamFallbackHeader, "buffered")
+			writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "too_many_streams",
+				"Too many concurrent streams, retry later or without streaming")
+			return
+		}
+		defer release()
+		resp, err := h.sendChatRequest(ctx, newReq)
+		duration := time.Since(startTime)
+		if err != nil {
+			h.writeChatError(w, ctx, err)
+			return
+		}
+		defer resp.Body.Close()
+		h.setTimingHeaders(w, requestStart, duration)
+		closeAfterStream(w, r)
+		usage := h.streamChatCompletion(ctx, w, log, resp, openaiReq.Model, openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage)
+		audit.Usage = &usage
 		return
 	}
 
-	openaiResp := OpenAIChatResponse{
-		ID:      "chatcmpl-" + randomString(10),
-		Object:  "chat.completion",
-		Created: time.Now().Unix(),
-		Model:   openaiReq.Model,
-		Choices: []Choice{
-			{
-				Index:        0,
+	complete := func(ctx context.Context) (OpenAIChatResponse, error) {
+		webuiResps, err := h.fetchChatChoices(ctx, newReq, choices)
+		if err != nil {
+			return OpenAIChatResponse{}, err
+		}
+		openaiResp := OpenAIChatResponse{
+			ID:                "chatcmpl-" + randomString(10),
+			Object:            "chat.completion",
+			Created:           time.Now().Unix(),
+			Model:             openaiReq.Model,
+			ServiceTier:       openaiReq.ServiceTier,
+			SystemFingerprint: h.systemFingerprint(webuiResps[0].SystemFingerprint),
+		}
+		for i, webuiResp := range webuiResps {
+			if h.Config.NormalizeAssistantRole {
+				webuiResp.Message.Role = "assistant"
+			}
+			openaiResp.Choices = append(openaiResp.Choices, Choice{
+				Index:        i,
 				Message:      webuiResp.Message,
-				FinishReason: "stop",
-			},
-		},
-		Usage: TokenUsage{
-			PromptTokens:     0,
-			CompletionTokens: 0,
-			TotalTokens:      0,
-		},
+				Logprobs:     webuiResp.Logprobs,
+				FinishReason: webuiResp.Message.finishReason(),
+			})
+			openaiResp.Usage = openaiResp.Usage.add(webuiResp.tokenUsage())
+		}
+		h.metrics.observeUsage(openaiReq.Model, openaiResp.Usage)
+		return openaiResp, nil
 	}
+	var openaiResp OpenAIChatResponse
+	if key := h.coalesceKey(r, targetURL, body); key != "" {
+		// The shared call must not end with the client that started it, whose
+		// retries are what the other requests are.
+		sharedCtx, cancelShared := h.upstreamContext(context.WithoutCancel(ctx), false)
+		defer cancelShared()
+		var shared bool
+		openaiResp, shared, err = h.coalescer.do(ctx, key, func() (OpenAIChatResponse, error) {
+			return complete(sharedCtx)
+		})
+		if shared {
+			log.Info("Answered chat completion with the response of a duplicate request", "coalesce_key", key)
+		}
+	} else {
+		openaiResp, err = complete(ctx)
+	}
+	duration := time.Since(startTime)
+	if err != nil {
+		h.writeChatError(w, ctx, err)
+		return
+	}
+	audit.Usage = &openaiResp.Usage
 
+	h.setTimingHeaders(w, requestStart, duration)
+	h.setUsageHeaders(w, openaiResp.Usage)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(openaiResp); err != nil {
 		log.Error(err, "Failed to encode/write OpenAI response")
 	}
-	log.Info("Successfully handled chat completion request", "response_id", openaiResp.ID)
+	h.accessLog(log).Info("Successfully handled chat completion request", "response_id", openaiResp.ID)
+}
+
+// setTimingHeaders reports the upstream call duration and the remaining gateway-side
+// processing time as response headers when TimingHeaders is enabled.
+func (h *handler) setTimingHeaders(w http.ResponseWriter, requestStart time.Time, upstream time.Duration) {
+	if !h.Config.TimingHeaders {
+		return
+	}
+	gateway := time.Since(requestStart) - upstream
+	w.Header().Set("X-Upstream-Duration-Ms", strconv.FormatInt(upstream.Milliseconds(), 10))
+	w.Header().Set("X-Gateway-Duration-Ms", strconv.FormatInt(gateway.Milliseconds(), 10))
+}
+
+// setUsageHeaders reports usage as response headers when UsageHeaders is
+// enabled, for clients and proxies that meter without parsing the body.
+func (h *handler) setUsageHeaders(w http.ResponseWriter, usage TokenUsage) {
+	if !h.Config.UsageHeaders {
+		return
+	}
+	w.Header().Set("X-Usage-Prompt-Tokens", strconv.Itoa(usage.PromptTokens))
+	w.Header().Set("X-Usage-Completion-Tokens", strconv.Itoa(usage.CompletionTokens))
+	w.Header().Set("X-Usage-Total-Tokens", strconv.Itoa(usage.TotalTokens))
 }
 
 func (h *handler) forwardAndTransform(w http.ResponseWriter, r *http.Request) {
 	log := logger.FromContext(r.Context()).WithValues("request_id", randomString(8))
+	if limit := h.Config.MaxPathLength; limit > 0 && len(r.URL.Path) > limit {
+		log.Info("Rejected forwarding of an over-long path", "path_length", len(r.URL.Path), "max_path_length", limit)
+		writeOpenAIError(w, http.StatusRequestURITooLong, "invalid_request_error", "path_too_long",
+			fmt.Sprintf("Request path of %d characters exceeds the limit of %d", len(r.URL.Path), limit))
+		return
+	}
 	targetPath := strings.TrimPrefix(r.URL.Path, "/v1")
 	targetURL := h.Config.OpenWebUIURL + targetPath
-	log.Info("Forwarding request", "target_url", targetURL)
-
-	var req *http.Request
-	var err error
+	h.accessLog(log).Info("Forwarding request", "target_url", targetURL)
 
+	var body []byte
 	if r.Method == http.MethodPost {
-		body, readErr := io.ReadAll(r.Body)
+		var readErr error
+		body, readErr = io.ReadAll(r.Body)
 		if readErr != nil {
+			if isClientAbort(r, readErr) {
+				log.Info("Client disconnected while sending the request body", "error", readErr.Error())
+				return
+			}
 			log.Error(readErr, "Failed to read request body for forwarding")
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			writeBodyReadError(w, readErr)
 			return
 		}
 		defer r.Body.Close()
-		req, err = http.NewRequest("POST", targetURL, bytes.NewReader(body))
-	} else {
-		req, err = http.NewRequest(r.Method, targetURL, nil)
 	}
 
-	if err != nil {
-		log.Error(err, "Failed to create forward request", "method", r.Method, "url", targetURL)
-		http.Error(w, "Failed to create forward request", http.StatusInternalServerError)
-		return
-	}
-
-	for k, vv := range r.Header {
-		if k != "Host" && k != "Content-Length" {
-			for _, v := range vv {
-				req.Header.Add(k, v)
+	ctx, cancel := h.upstreamContext(logger.WithContext(r.Context(), log), false)
+	defer cancel()
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		var req *http.Request
+		var err error
+		if r.Method == http.MethodPost {
+			req, err = http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body))
+		} else {
+			req, err = http.NewRequestWithContext(ctx, r.Method, targetURL, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, vv := range r.Header {
+			if k != "Host" && k != "Content-Length" {
+				for _, v := range vv {
+					req.Header.Add(k, v)
+				}
 			}
 		}
+		h.setUpstreamAuth(req, r)
+		h.setOrgHeaders(req, r)
+		return req, nil
 	}
 
-	client := &http.Client{}
 	startTime := time.Now()
-	resp, err := client.Do(req)
+	resp, err := h.doUpstream(ctx, newReq)
 	duration := time.Since(startTime)
 	if err != nil {
 		log.Error(err, "Failed to forward request to upstream", "url", targetURL, "duration_ms", duration.Milliseconds())
-		http.Error(w, "Failed to contact upstream service", http.StatusBadGateway)
+		if h.writeUpstreamTimeout(w, ctx, err) {
+			return
+		}
+		writeConnError(w, err)
 		return
 	}
 	defer resp.Body.Close()
 
-	log.Info("Received response from upstream", "url", targetURL, "status_code", resp.StatusCode, "duration_ms", duration.Milliseconds())
-
+	h.accessLog(log).Info("Received response from upstream", "url", targetURL, "status_code", resp.StatusCode, "duration_ms", duration.Milliseconds())
+
+	var respBody io.Reader = resp.Body
+	if r.Method == http.MethodHead {
+		// The upstream omits the body; keep its headers, Content-Length included.
+		respBody = http.NoBody
+	} else if targetPath == "/models" && resp.StatusCode == http.StatusOK {
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Error(err, "Failed to read models listing from upstream")
+			http.Error(w, "Failed to read upstream response", http.StatusBadGateway)
+			return
+		}
+		respBody = bytes.NewReader(normalizeModelsList(raw))
+		resp.Header.Del("Content-Length")
+	}
 	for k, vv := range resp.Header {
 		for _, v := range vv {
 			w.Header().Add(k, v)
 		}
 	}
+	if w.Header().Get("Content-Type") == "" && h.Config.DefaultContentType != "" && jsonEndpoints[targetPath] {
+		// Keep clients from sniffing a JSON body as something else.
+		w.Header().Set("Content-Type", h.Config.DefaultContentType)
+		log.V(1).Info("Applied default Content-Type", "content_type", h.Config.DefaultContentType)
+	}
 
 	w.WriteHeader(resp.StatusCode)
 
-	if _, copyErr := io.Copy(w, resp.Body); copyErr != nil {
+	if _, copyErr := io.Copy(w, respBody); copyErr != nil {
 		log.Error(copyErr, "Failed to copy upstream response body")
 	}
 
-	log.Info("Forwarded request processed", "original_path", r.URL.Path, "target_path", targetPath, "status_code", resp.StatusCode)
+	h.accessLog(log).Info("Forwarded request processed", "original_path", r.URL.Path, "target_path", targetPath, "status_code", resp.StatusCode)
+}
+
+// systemFingerprint returns the system_fingerprint of a chat response: the one
+// reported by the upstream if any, Config.SystemFingerprint otherwise.
+func (h *handler) systemFingerprint(upstream string) string {
+	if upstream != "" {
+		return upstream
+	}
+	return h.Config.SystemFingerprint
+}
+
+// serviceStatus is the built-in response to GET /.
+type serviceStatus struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+}
+
+// handleServiceRoot answers GET / itself rather than proxying the upstream root,
+// which is usually an HTML page, so root health checks get a sensible answer.
+func handleServiceRoot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(serviceStatus{Service: "openai-gateway", Status: "ok"}); err != nil {
+		logger.FromContext(r.Context()).Error(err, "Failed to encode service status")
+	}
 }
 
 func (h *handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	log := logger.FromContext(r.Context()).WithValues("request_id", randomString(8))
 	log.V(1).Info("Health check request received")
-	req, err := http.NewRequest("GET", h.Config.OpenWebUIURL+"/health", nil)
+	if h.maintenance.Load() {
+		// Stay alive for probes so that the maintenance state survives.
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("DEGRADED: maintenance mode"))
+		log.V(1).Info("Health check answered as degraded during maintenance")
+		return
+	}
+	req, err := http.NewRequest(h.healthMethod(), h.Config.OpenWebUIURL+"/health", nil)
 	if err != nil {
 		log.Error(err, "Failed to create health check request")
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	upstream := h.upstreamClient()
+	client := &http.Client{Timeout: 5 * time.Second, Transport: upstream.Transport, CheckRedirect: upstream.CheckRedirect}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Error(err, "Health check failed: could not reach Open-WebUI")
@@ -452,7 +1449,24 @@ func (h *handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
-	log.Info("Health check successful")
+	h.accessLog(log).Info("Health check successful")
+}
+
+// healthMethod returns the method of the upstream health probe.
+func (h *handler) healthMethod() string {
+	if h.Config.HealthMethod == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(h.Config.HealthMethod)
+}
+
+// validateHealthMethod checks that method is usable for the upstream health probe.
+func validateHealthMethod(method string) error {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+		return nil
+	}
+	return fmt.Errorf("unsupported health check method %q, expected GET, HEAD, POST or OPTIONS", method)
 }
 
 func randomString(_ int) string {
@@ -9,11 +9,16 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
 )
 
 func TestHandler(t *testing.T) {
@@ -46,7 +51,7 @@ func TestHandler(t *testing.T) {
 	reqBody := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
 	req, err := http.NewRequest("POST", ts.URL+"/v1/chat/completions", bytes.NewBuffer([]byte(reqBody)))
 	if err != nil {
-		 t.Fatalf("Failed to create request: %v", err)
+		t.Fatalf("Failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
@@ -56,7 +61,7 @@ func TestHandler(t *testing.T) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		 t.Fatalf("Failed to send request: %v", err)
+		t.Fatalf("Failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -108,22 +113,22 @@ func TestHandleChatCompletions(t *testing.T) {
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
-		 t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
 	}
 
 	var chatResp OpenAIChatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		 t.Fatalf("Failed to decode response: %v", err)
+		t.Fatalf("Failed to decode response: %v", err)
 	}
 
 	if chatResp.Model != chatReq.Model {
-		 t.Errorf("Expected model %s, got %s", chatReq.Model, chatResp.Model)
+		t.Errorf("Expected model %s, got %s", chatReq.Model, chatResp.Model)
 	}
 	if len(chatResp.Choices) != 1 {
-		 t.Errorf("Expected 1 choice, got %d", len(chatResp.Choices))
+		t.Errorf("Expected 1 choice, got %d", len(chatResp.Choices))
 	}
 	if chatResp.Choices[0].Message.Content != "Hello from mock server" {
-		 t.Errorf("Expected response content 'Hello from mock server', got '%s'", chatResp.Choices[0].Message.Content)
+		t.Errorf("Expected response content 'Hello from mock server', got '%s'", chatResp.Choices[0].Message.Content)
 	}
 }
 
@@ -151,12 +156,40 @@ func TestForwardAndTransform(t *testing.T) {
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
-		 t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
 	}
 
 	body, _ := io.ReadAll(resp.Body)
 	if !bytes.Contains(body, []byte("model1")) {
-		 t.Errorf("Expected response to contain 'model1', got '%s'", string(body))
+		t.Errorf("Expected response to contain 'model1', got '%s'", string(body))
+	}
+}
+
+func TestHealthHandlerMethod(t *testing.T) {
+	tsMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer tsMock.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	for method, want := range map[string]int{"": http.StatusServiceUnavailable, "head": http.StatusOK, http.MethodHead: http.StatusOK} {
+		h := &handler{Config: &Config{OpenWebUIURL: tsMock.URL, HealthMethod: method}}
+		w := httptest.NewRecorder()
+		h.handleHealth(w, httptest.NewRequest("GET", "/healthz", nil).WithContext(ctx))
+		if w.Code != want {
+			t.Errorf("HealthMethod %q: Expected status code %d, got %d", method, want, w.Code)
+		}
+	}
+
+	if err := validateHealthMethod("HEAD"); err != nil {
+		t.Errorf("Expected HEAD to be a valid health method, got %v", err)
+	}
+	if err := validateHealthMethod("DELETE"); err == nil {
+		t.Errorf("Expected an error for an unsupported health method")
 	}
 }
 
@@ -186,12 +219,12 @@ func TestHealthHandler(t *testing.T) {
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
-		 t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
 	}
 
 	body, _ := io.ReadAll(resp.Body)
 	if string(body) != "OK" {
-		 t.Errorf("Expected response body 'OK', got '%s'", string(body))
+		t.Errorf("Expected response body 'OK', got '%s'", string(body))
 	}
 }
 
@@ -282,7 +315,7 @@ func TestForwardAndTransformWithErrorResponse(t *testing.T) {
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusInternalServerError {
-		 t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, resp.StatusCode)
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, resp.StatusCode)
 	}
 }
 
@@ -391,7 +424,7 @@ func TestHandleQuitSignal(t *testing.T) {
 	// handleQuitSignal now gets logger from context
 	handlerFunc := handleQuitSignal(stopChan, &closeOnce)
 
-	req := httptest.NewRequest("GET", "/quitquitquit", nil)
+	req := httptest.NewRequest("POST", "/quitquitquit", nil)
 	// Inject logger into request context
 	ctx := logr.NewContext(context.Background(), logr.Discard())
 	req = req.WithContext(ctx)
@@ -524,8 +557,8 @@ func TestServerLifecycle(t *testing.T) {
 
 	// Create Config for the test
 	cfg := &Config{
-		Port:               mainPort,
-		QuitPort:           quitPortNum,
+		Port:     mainPort,
+		QuitPort: quitPortNum,
 		// Use a short timeout for testing
 		ShutdownTimeoutSec: 1,
 		OpenWebUIURL:       mockWebUI.URL,
@@ -556,12 +589,11 @@ func TestServerLifecycle(t *testing.T) {
 	}()
 	go func() {
 		// Pass context to runQuitServer
-		runQuitServer(ctx, quitSrv)
+		runQuitServer(ctx, cfg, quitSrv)
 		// Signal completion or error handled internally
 		serverErrChan <- nil
 	}()
 
-
 	// Wait briefly for servers to start
 	time.Sleep(100 * time.Millisecond)
 
@@ -570,7 +602,7 @@ func TestServerLifecycle(t *testing.T) {
 		// Send quit signal
 		quitURL := fmt.Sprintf("http://127.0.0.1:%d/quitquitquit", cfg.QuitPort)
 		// Need to inject logger into context for the quit request
-		quitReq, _ := http.NewRequest("GET", quitURL, nil)
+		quitReq, _ := http.NewRequest("POST", quitURL, nil)
 		// Use the main context which has the logger
 		quitReq = quitReq.WithContext(ctx)
 
@@ -596,7 +628,7 @@ func TestServerLifecycle(t *testing.T) {
 		// Perform shutdown (simulated), passing context and config
 		shutdownCompleteChan := make(chan struct{})
 		go func() {
-			shutdownServers(ctx, cfg, mainSrv, quitSrv)
+			shutdownServers(ctx, cfg, mainSrv, quitSrv, &sync.Once{})
 			close(shutdownCompleteChan)
 		}()
 
@@ -623,7 +655,6 @@ func TestServerLifecycle(t *testing.T) {
 			}
 		}
 
-
 		// Verify servers are stopped (check if ports are free)
 		// Allow a bit more time for ports to be released
 		time.Sleep(200 * time.Millisecond)
@@ -665,7 +696,6 @@ func TestServerLifecycle(t *testing.T) {
 			close(waitDone)
 		}()
 
-
 		select {
 		case <-waitDone:
 		// Test assumes waitForShutdownSignal is correctly waiting
@@ -683,7 +713,6 @@ func TestServerLifecycle(t *testing.T) {
 		testCtx := logr.NewContext(context.Background(), baseLog)
 		waitDone := make(chan struct{})
 
-
 		go func() {
 			// Simulate receiving internal signal after a short delay
 			time.Sleep(100 * time.Millisecond)
@@ -722,3 +751,1037 @@ func isPortInUse(port int) bool {
 	// Successful connection indicates port is in use
 	return true
 }
+
+func TestHandleChatCompletionsUsageHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{
+			Message: MessageItem{Role: "assistant", Content: "Hi"},
+			Usage:   &TokenUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+		})
+	}))
+	defer ts.Close()
+
+	for _, enabled := range []bool{true, false} {
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, UsageHeaders: enabled}}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		var resp OpenAIChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		headers := map[string]int{
+			"X-Usage-Prompt-Tokens":     resp.Usage.PromptTokens,
+			"X-Usage-Completion-Tokens": resp.Usage.CompletionTokens,
+			"X-Usage-Total-Tokens":      resp.Usage.TotalTokens,
+		}
+		for name, want := range headers {
+			value := w.Header().Get(name)
+			if !enabled {
+				if value != "" {
+					t.Errorf("Expected no %s header when disabled, got %q", name, value)
+				}
+				continue
+			}
+			if value != strconv.Itoa(want) {
+				t.Errorf("Expected %s to match the body usage %d, got %q", name, want, value)
+			}
+		}
+	}
+}
+
+func TestHandleChatCompletionsTimingHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	for _, enabled := range []bool{true, false} {
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, TimingHeaders: enabled}}
+		body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+
+		h.handleChatCompletions(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		for _, name := range []string{"X-Upstream-Duration-Ms", "X-Gateway-Duration-Ms"} {
+			value := resp.Header.Get(name)
+			if !enabled {
+				if value != "" {
+					t.Errorf("Expected no %s header when disabled, got %q", name, value)
+				}
+				continue
+			}
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				t.Errorf("Expected numeric %s header, got %q", name, value)
+			}
+		}
+		if enabled {
+			ms, _ := strconv.ParseInt(resp.Header.Get("X-Upstream-Duration-Ms"), 10, 64)
+			if ms < 20 {
+				t.Errorf("Expected upstream duration of at least 20ms, got %d", ms)
+			}
+		}
+	}
+}
+
+// captureUpstreamPayload sends reqBody to handleChatCompletions and returns the
+// JSON payload received by the mock upstream as a generic map.
+func captureUpstreamPayload(t *testing.T, cfg *Config, reqBody string) map[string]any {
+	t.Helper()
+	var payload map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode upstream payload: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	cfg.OpenWebUIURL = ts.URL
+	h := &handler{Config: cfg}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d, body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	return payload
+}
+
+func TestHandleChatCompletionsPenalties(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "frequency_penalty": 0.5, "presence_penalty": 0}`)
+	if v, ok := payload["frequency_penalty"]; !ok || v != 0.5 {
+		t.Errorf("Expected frequency_penalty 0.5 to be forwarded, got %v", v)
+	}
+	if v, ok := payload["presence_penalty"]; !ok || v != 0.0 {
+		t.Errorf("Expected explicit presence_penalty 0 to be forwarded, got %v", v)
+	}
+
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	for _, key := range []string{"frequency_penalty", "presence_penalty"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("Expected %s to be omitted when unset", key)
+		}
+	}
+}
+
+func TestHandleChatCompletionsParallelToolCalls(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "parallel_tool_calls": false}`)
+	if v, ok := payload["parallel_tool_calls"]; !ok || v != false {
+		t.Errorf("Expected explicit parallel_tool_calls false to be forwarded, got %v", v)
+	}
+
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if _, ok := payload["parallel_tool_calls"]; ok {
+		t.Errorf("Expected parallel_tool_calls to be omitted when unset")
+	}
+}
+
+func TestHandleChatCompletionsTools(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [`+
+		`{"role": "user", "content": "Weather?"},`+
+		`{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{}"}}]},`+
+		`{"role": "tool", "content": "Sunny", "tool_call_id": "call_1"}],`+
+		`"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}], "tool_choice": "auto"}`)
+
+	tools, ok := payload["tools"].([]any)
+	if !ok || len(tools) != 1 {
+		t.Errorf("Expected tools to be forwarded, got %v", payload["tools"])
+	}
+	if payload["tool_choice"] != "auto" {
+		t.Errorf("Expected tool_choice auto to be forwarded, got %v", payload["tool_choice"])
+	}
+	messages, _ := payload["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 forwarded messages, got %v", payload["messages"])
+	}
+	if id := messages[2].(map[string]any)["tool_call_id"]; id != "call_1" {
+		t.Errorf("Expected tool_call_id call_1 on the tool message, got %v", id)
+	}
+
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	for _, key := range []string{"tools", "tool_choice"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("Expected %s to be omitted when unset", key)
+		}
+	}
+}
+
+func TestHandleChatCompletionsStore(t *testing.T) {
+	for _, store := range []bool{true, false} {
+		payload := captureUpstreamPayload(t, &Config{}, fmt.Sprintf(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "store": %v}`, store))
+		if v, ok := payload["store"]; !ok || v != store {
+			t.Errorf("Expected explicit store %v to be forwarded, got %v", store, v)
+		}
+	}
+
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if _, ok := payload["store"]; ok {
+		t.Errorf("Expected store to be omitted when unset")
+	}
+}
+
+func TestHandleChatCompletionsDefaultModel(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{DefaultModel: "default-model"}, `{"messages": [{"role": "user", "content": "Hello"}]}`)
+	if payload["model"] != "default-model" {
+		t.Errorf("Expected default model to be forwarded, got %v", payload["model"])
+	}
+
+	payload = captureUpstreamPayload(t, &Config{DefaultModel: "default-model"}, `{"model": "explicit-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if payload["model"] != "explicit-model" {
+		t.Errorf("Expected explicit model to take precedence, got %v", payload["model"])
+	}
+}
+
+func TestHandleChatCompletionsMissingModel(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"messages": [{"role": "user", "content": "Hello"}]}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleChatCompletionsLogitBias(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "logit_bias": {"50256": -100, "1234": 5}}`)
+	bias, ok := payload["logit_bias"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected logit_bias to be forwarded, got %v", payload["logit_bias"])
+	}
+	if bias["50256"] != -100.0 || bias["1234"] != 5.0 {
+		t.Errorf("Expected logit_bias to be forwarded unchanged, got %v", bias)
+	}
+
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if _, ok := payload["logit_bias"]; ok {
+		t.Errorf("Expected logit_bias to be omitted when absent")
+	}
+}
+
+func TestForwardMaxPathLength(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxPathLength: 64}}
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	w := httptest.NewRecorder()
+	h.handleRoot(w, httptest.NewRequest("GET", "/v1/"+strings.Repeat("a", 64), nil).WithContext(ctx))
+	if w.Code != http.StatusRequestURITooLong {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestURITooLong, w.Code)
+	}
+	if calls != 0 {
+		t.Errorf("Expected the over-long path not to be forwarded, got %d upstream calls", calls)
+	}
+
+	w = httptest.NewRecorder()
+	h.handleRoot(w, httptest.NewRequest("GET", "/v1/embeddings", nil).WithContext(ctx))
+	if w.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected a short path to be forwarded, got status %d after %d upstream calls", w.Code, calls)
+	}
+}
+
+func TestHandleOptions(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	req := httptest.NewRequest("OPTIONS", "/v1/chat/completions", nil)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleOptions(h.handleRoot)(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, POST, OPTIONS" {
+		t.Errorf("Expected Allow header 'GET, POST, OPTIONS', got %q", allow)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+}
+
+func TestHandleRootMethodNotAllowed(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	req := httptest.NewRequest("DELETE", "/v1/chat/completions", nil)
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleRoot(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow == "" {
+		t.Errorf("Expected Allow header on 405 response")
+	}
+}
+
+func TestForwardHead(t *testing.T) {
+	var upstreamMethod, upstreamPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamMethod, upstreamPath = r.Method, r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream", "open-webui")
+		w.Write([]byte(`{"object": "list", "data": [{"id": "test-model"}]}`))
+	}))
+	defer ts.Close()
+
+	send := func(cfg *Config) *httptest.ResponseRecorder {
+		h := newHandler(cfg)
+		req := httptest.NewRequest(http.MethodHead, "/v1/models", nil)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleOptions(h.handleRoot)(w, req)
+		return w
+	}
+
+	w := send(&Config{OpenWebUIURL: ts.URL, ForwardHead: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if upstreamMethod != http.MethodHead || upstreamPath != "/models" {
+		t.Errorf("Expected HEAD /models upstream, got %s %s", upstreamMethod, upstreamPath)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type 'application/json', got %q", ct)
+	}
+	if v := w.Header().Get("X-Upstream"); v != "open-webui" {
+		t.Errorf("Expected upstream header to be forwarded, got %q", v)
+	}
+	if w.Header().Get("Content-Length") == "" {
+		t.Errorf("Expected upstream Content-Length to be forwarded")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+
+	upstreamMethod = ""
+	w = send(&Config{OpenWebUIURL: ts.URL})
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d without ForwardHead, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != allowedMethods {
+		t.Errorf("Expected Allow header %q, got %q", allowedMethods, allow)
+	}
+	if upstreamMethod != "" {
+		t.Errorf("Expected no upstream request without ForwardHead, got %s", upstreamMethod)
+	}
+}
+
+func TestHandleChatCompletionsChatID(t *testing.T) {
+	var upstreamChatID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		upstreamChatID = upstreamReq.ChatID
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	send := func(chatID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		if chatID != "" {
+			req.Header.Set("X-Chat-Id", chatID)
+		}
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		return w
+	}
+
+	w := send("chat-123")
+	if upstreamChatID != "chat-123" {
+		t.Errorf("Expected chat ID chat-123 to be forwarded upstream, got %q", upstreamChatID)
+	}
+	if got := w.Header().Get("X-Chat-Id"); got != "chat-123" {
+		t.Errorf("Expected chat ID chat-123 to be echoed, got %q", got)
+	}
+
+	w = send("")
+	generated := w.Header().Get("X-Chat-Id")
+	if generated == "" {
+		t.Fatalf("Expected a chat ID to be generated")
+	}
+	if upstreamChatID != generated {
+		t.Errorf("Expected generated chat ID %q to be forwarded upstream, got %q", generated, upstreamChatID)
+	}
+}
+
+func TestHandleChatCompletionsPipelineID(t *testing.T) {
+	var upstreamPipelineID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		upstreamPipelineID = upstreamReq.PipelineID
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		defaultPipeline string
+		header          string
+		body            string
+		want            string
+	}{
+		{"header", "", "summarizer", "", "summarizer"},
+		{"body", "", "", "translator", "translator"},
+		{"header overrides body", "", "summarizer", "translator", "summarizer"},
+		{"default", "fallback", "", "", "fallback"},
+		{"body overrides default", "fallback", "", "translator", "translator"},
+		{"none", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		upstreamPipelineID = ""
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, DefaultPipeline: tt.defaultPipeline}}
+		body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}, PipelineID: tt.body})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		if tt.header != "" {
+			req.Header.Set("X-Pipeline-Id", tt.header)
+		}
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusOK, w.Code)
+		}
+		if upstreamPipelineID != tt.want {
+			t.Errorf("%s: Expected pipeline ID %q upstream, got %q", tt.name, tt.want, upstreamPipelineID)
+		}
+	}
+}
+
+func TestHandleChatCompletionsLogprobs(t *testing.T) {
+	logprobs := `{"content":[{"token":"Hi","logprob":-0.25,"bytes":[72,105],"top_logprobs":[]}]}`
+	var upstreamReq map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi"}, "logprobs": ` + logprobs + `, "finish_reason": "stop"}]}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "logprobs": true, "top_logprobs": 3}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if upstreamReq["logprobs"] != true || upstreamReq["top_logprobs"] != float64(3) {
+		t.Errorf("Expected logprobs and top_logprobs to be forwarded, got %v and %v", upstreamReq["logprobs"], upstreamReq["top_logprobs"])
+	}
+	var chatResp OpenAIChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&chatResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(chatResp.Choices) != 1 || string(chatResp.Choices[0].Logprobs) != logprobs {
+		t.Errorf("Expected upstream logprobs to be passed through, got %+v", chatResp.Choices)
+	}
+
+	// Logprobs are not requested upstream unless the client asked for them.
+	payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if _, ok := payload["logprobs"]; ok {
+		t.Errorf("Expected logprobs to be omitted when not requested, got %v", payload["logprobs"])
+	}
+}
+
+func TestHandleChatCompletionsServiceTier(t *testing.T) {
+	var upstreamReq map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamReq = nil
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	send := func(body string) map[string]any {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := send(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "service_tier": "flex"}`)
+	if upstreamReq["service_tier"] != "flex" {
+		t.Errorf("Expected service_tier to be forwarded, got %v", upstreamReq["service_tier"])
+	}
+	if resp["service_tier"] != "flex" {
+		t.Errorf("Expected service_tier to be echoed, got %v", resp["service_tier"])
+	}
+
+	resp = send(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if _, ok := upstreamReq["service_tier"]; ok {
+		t.Errorf("Expected service_tier to be omitted upstream, got %v", upstreamReq["service_tier"])
+	}
+	if _, ok := resp["service_tier"]; ok {
+		t.Errorf("Expected service_tier to be omitted from the response, got %v", resp["service_tier"])
+	}
+}
+
+func TestHandleChatCompletionsOllamaUsage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}, "prompt_eval_count": 26, "eval_count": 298}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	var chatResp OpenAIChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&chatResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := TokenUsage{PromptTokens: 26, CompletionTokens: 298, TotalTokens: 324}
+	if chatResp.Usage != want {
+		t.Errorf("Expected usage %+v, got %+v", want, chatResp.Usage)
+	}
+}
+
+func TestTokenUsagePrefersUsageObject(t *testing.T) {
+	resp := OpenWebUIChatResponse{
+		Usage:           &TokenUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+		PromptEvalCount: 10,
+		EvalCount:       20,
+	}
+	if got := resp.tokenUsage(); got.TotalTokens != 3 {
+		t.Errorf("Expected usage object to take precedence, got %+v", got)
+	}
+	if got := (OpenWebUIChatResponse{}).tokenUsage(); got != (TokenUsage{}) {
+		t.Errorf("Expected zero usage without counts, got %+v", got)
+	}
+}
+
+func TestHandleChatCompletionsEmptyUpstreamMessage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "no usable message") {
+		t.Errorf("Expected a clear error message, got %q", w.Body.String())
+	}
+}
+
+func TestForwardAndTransformDefaultContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A nil value keeps net/http from sniffing a Content-Type.
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		want        string
+	}{
+		{"json endpoint", "/v1/models", defaultContentType, "application/json"},
+		{"custom default", "/v1/models", "application/json; charset=utf-8", "application/json; charset=utf-8"},
+		{"disabled", "/v1/models", "", ""},
+		{"unknown endpoint", "/v1/files/1/content", defaultContentType, ""},
+	}
+	for _, tt := range tests {
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, DefaultContentType: tt.contentType}}
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.forwardAndTransform(w, req)
+
+		if got := w.Result().Header.Get("Content-Type"); got != tt.want {
+			t.Errorf("%s: Expected Content-Type %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHandleChatCompletionsMaxPromptChars(t *testing.T) {
+	// Two messages of 3 and 4 characters; multi-byte runes count once.
+	reqBody := `{"model": "test-model", "messages": [{"role": "system", "content": "héy"}, {"role": "user", "content": "ciao"}]}`
+	payload := captureUpstreamPayload(t, &Config{MaxPromptChars: 7}, reqBody)
+	if payload["model"] != "test-model" {
+		t.Errorf("Expected a request at the limit to be forwarded, got %v", payload)
+	}
+
+	var upstreamCalled bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxPromptChars: 6}}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Prompt too long") {
+		t.Errorf("Expected a prompt length error, got %q", w.Body.String())
+	}
+	if upstreamCalled {
+		t.Errorf("Expected an oversized prompt not to be forwarded")
+	}
+}
+
+func TestHandleChatCompletionsInvalidUTF8(t *testing.T) {
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url"}}
+	body := []byte("{\"model\": \"test-model\", \"messages\": [{\"role\": \"user\", \"content\": \"caf\xe9\"}]}")
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", ct)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to decode error response %q: %v", w.Body.String(), err)
+	}
+	if errResp.Error.Type != "invalid_request_error" || errResp.Error.Code != "invalid_encoding" {
+		t.Errorf("Expected an invalid_encoding request error, got %+v", errResp.Error)
+	}
+	if !strings.Contains(errResp.Error.Message, "UTF-8") {
+		t.Errorf("Expected the error to name the encoding problem, got %q", errResp.Error.Message)
+	}
+}
+
+func TestHandleChatCompletionsKnowledge(t *testing.T) {
+	reqBody := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "files": [{"type": "collection", "id": "docs"}], "collections": ["handbook"]}`
+	payload := captureUpstreamPayload(t, &Config{}, reqBody)
+
+	files, ok := payload["files"].([]any)
+	if !ok || len(files) != 1 {
+		t.Fatalf("Expected files to be forwarded, got %v", payload["files"])
+	}
+	if file, _ := files[0].(map[string]any); file["type"] != "collection" || file["id"] != "docs" {
+		t.Errorf("Expected files to be forwarded unchanged, got %v", files[0])
+	}
+	if collections, ok := payload["collections"].([]any); !ok || len(collections) != 1 || collections[0] != "handbook" {
+		t.Errorf("Expected collections to be forwarded unchanged, got %v", payload["collections"])
+	}
+
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	for _, key := range []string{"files", "collections"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("Expected %s to be omitted when absent", key)
+		}
+	}
+}
+
+func TestHandleChatCompletionsAllowedModels(t *testing.T) {
+	allowed := []string{"small-model", "default-model"}
+	payload := captureUpstreamPayload(t, &Config{AllowedModels: allowed}, `{"model": "small-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if payload["model"] != "small-model" {
+		t.Errorf("Expected an allowed model to be forwarded, got %v", payload["model"])
+	}
+	payload = captureUpstreamPayload(t, &Config{AllowedModels: allowed, DefaultModel: "default-model"}, `{"messages": [{"role": "user", "content": "Hello"}]}`)
+	if payload["model"] != "default-model" {
+		t.Errorf("Expected an allowed default model to be forwarded, got %v", payload["model"])
+	}
+	payload = captureUpstreamPayload(t, &Config{}, `{"model": "any-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+	if payload["model"] != "any-model" {
+		t.Errorf("Expected any model to be forwarded without an allow-list, got %v", payload["model"])
+	}
+
+	h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url", AllowedModels: allowed}}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "large-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to decode error response %q: %v", w.Body.String(), err)
+	}
+	if errResp.Error.Code != "model_not_allowed" || !strings.Contains(errResp.Error.Message, "large-model") {
+		t.Errorf("Expected a model_not_allowed error naming the model, got %+v", errResp.Error)
+	}
+}
+
+func TestShutdownDrainProgress(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, args)
+	}, funcr.Options{})
+	ctx := logr.NewContext(context.Background(), log)
+	cfg := &Config{OpenWebUIURL: upstream.URL, Port: findAvailablePort(t), ShutdownTimeoutSec: 5, DisableQuitServer: true}
+	h := newHandler(cfg)
+	stopChan := make(chan struct{})
+	var closeOnce sync.Once
+	mainSrv, quitSrv := setupServers(logr.NewContext(context.Background(), logr.Discard()), cfg, h, stopChan, &closeOnce)
+	startServers(ctx, cfg, mainSrv, quitSrv, stopChan, &closeOnce)
+	deadline := time.Now().Add(2 * time.Second)
+	for !isPortInUse(cfg.Port) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the main server to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/v1/chat/completions", cfg.Port), "application/json",
+			strings.NewReader(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	for h.inFlight.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the request to be in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopProgress := h.logDrainProgress(ctx, 50*time.Millisecond)
+	shutdownServers(ctx, cfg, mainSrv, quitSrv, &sync.Once{})
+	stopProgress()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the in-flight request to complete during the drain, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	progress := 0
+	for _, line := range logs {
+		if strings.Contains(line, "Draining in-flight requests") && strings.Contains(line, `"in_flight"=1`) {
+			progress++
+		}
+	}
+	if progress == 0 {
+		t.Errorf("Expected progress logs reporting the in-flight request during the drain, got %v", logs)
+	}
+	if h.inFlight.Load() != 0 {
+		t.Errorf("Expected no in-flight requests after the drain, got %d", h.inFlight.Load())
+	}
+}
+
+func TestShutdownSimultaneousSignals(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{Port: findAvailablePort(t), QuitPort: findAvailablePort(t), ShutdownTimeoutSec: 5, OpenWebUIURL: "http://dummy-url"}
+	stopChan := make(chan struct{})
+	var closeOnce, shutdownOnce sync.Once
+	mainSrv, quitSrv := setupServers(ctx, cfg, newHandler(cfg), stopChan, &closeOnce)
+	startServers(ctx, cfg, mainSrv, quitSrv, stopChan, &closeOnce)
+
+	quitURL := fmt.Sprintf("http://127.0.0.1:%d/quitquitquit", cfg.QuitPort)
+	deadline := time.Now().Add(2 * time.Second)
+	for !isPortInUse(cfg.QuitPort) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the quit server to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Fire an OS signal and several quit requests at the same time.
+	sigChan := make(chan os.Signal, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sigChan <- syscall.SIGTERM
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := http.Post(quitURL, "text/plain", nil); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	waitForShutdown(ctx, sigChan, stopChan)
+
+	// Every trigger may go on to shut down; only the first call does the work.
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shutdownServers(ctx, cfg, mainSrv, quitSrv, &shutdownOnce)
+		}()
+	}
+	wg.Wait()
+
+	// A trigger arriving after shutdown must not close stopChan a second time.
+	handleQuitSignal(stopChan, &closeOnce)(httptest.NewRecorder(), httptest.NewRequest("POST", "/quitquitquit", nil).WithContext(ctx))
+	if isPortInUse(cfg.Port) || isPortInUse(cfg.QuitPort) {
+		t.Errorf("Expected both servers to be stopped after shutdown")
+	}
+}
+
+func TestHandleChatCompletionsMaxCompletionTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        string
+		wantMax       any
+		wantMaxTokens any
+	}{
+		{"max_completion_tokens only", `"max_completion_tokens": 128`, 128.0, nil},
+		{"legacy max_tokens mapped forward", `"max_tokens": 64`, 64.0, 64.0},
+		{"both fields unchanged", `"max_tokens": 64, "max_completion_tokens": 128`, 128.0, 64.0},
+		{"neither field", `"stream": false`, nil, nil},
+	}
+	for _, tt := range tests {
+		payload := captureUpstreamPayload(t, &Config{}, `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], `+tt.fields+`}`)
+		if got := payload["max_completion_tokens"]; got != tt.wantMax {
+			t.Errorf("%s: Expected max_completion_tokens %v, got %v", tt.name, tt.wantMax, got)
+		}
+		if got := payload["max_tokens"]; got != tt.wantMaxTokens {
+			t.Errorf("%s: Expected max_tokens %v, got %v", tt.name, tt.wantMaxTokens, got)
+		}
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer upstream.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{OpenWebUIURL: upstream.URL, MaxHeaderBytes: 1024, DisableQuitServer: true}
+	mainSrv, _ := setupServers(ctx, cfg, newHandler(cfg), make(chan struct{}), &sync.Once{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go mainSrv.Serve(listener)
+	defer mainSrv.Close()
+
+	send := func(cookie string) int {
+		req, _ := http.NewRequest("GET", "http://"+listener.Addr().String()+"/v1/models", nil)
+		req.Header.Set("Cookie", cookie)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// The server allows some slack beyond MaxHeaderBytes for buffering.
+	if status := send(strings.Repeat("a", 16*1024)); status != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected status code %d for oversized headers, got %d", http.StatusRequestHeaderFieldsTooLarge, status)
+	}
+	if status := send("session=abc"); status != http.StatusOK {
+		t.Errorf("Expected status code %d for small headers, got %d", http.StatusOK, status)
+	}
+}
+
+func TestHandleRootServiceStatus(t *testing.T) {
+	var upstreamPaths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPaths = append(upstreamPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>Open WebUI</html>"))
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL}}
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleRoot(w, req)
+		return w
+	}
+
+	w := send("GET", "/")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", ct)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"service":"openai-gateway","status":"ok"}` {
+		t.Errorf("Unexpected root response %s", body)
+	}
+	if len(upstreamPaths) != 0 {
+		t.Errorf("Expected GET / not to be forwarded, got upstream requests to %v", upstreamPaths)
+	}
+
+	send("GET", "/v1/")
+	if len(upstreamPaths) != 1 || upstreamPaths[0] != "/" {
+		t.Errorf("Expected /v1/ to still be forwarded to the upstream root, got %v", upstreamPaths)
+	}
+}
+
+func TestHandleChatCompletionsNormalizeAssistantRole(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chatReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&chatReq)
+		if chatReq.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"message\":{\"role\":\"bot\",\"content\":\"Hi\"}}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "bot", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	for _, normalize := range []bool{false, true} {
+		want := "bot"
+		if normalize {
+			want = "assistant"
+		}
+		h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, NormalizeAssistantRole: normalize}}
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		var chatResp OpenAIChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&chatResp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(chatResp.Choices) != 1 || chatResp.Choices[0].Message.Role != want {
+			t.Errorf("Expected role %q with normalization=%v, got %+v", want, normalize, chatResp.Choices)
+		}
+
+		w = httptest.NewRecorder()
+		h.handleChatCompletions(w, newStreamRequest(t))
+		events := readEvents(t, w.Result().Body)
+		var chunk OpenAIChatChunk
+		if len(events) == 0 || json.Unmarshal([]byte(events[0]), &chunk) != nil || len(chunk.Choices) != 1 {
+			t.Fatalf("Expected a first stream chunk, got %v", events)
+		}
+		if chunk.Choices[0].Delta.Role != want {
+			t.Errorf("Expected streamed role %q with normalization=%v, got %q", want, normalize, chunk.Choices[0].Delta.Role)
+		}
+	}
+}
+
+func TestHandleChatCompletionsSystemFingerprint(t *testing.T) {
+	var upstreamFingerprint string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chatReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&chatReq)
+		if chatReq.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hi\"}}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}, SystemFingerprint: upstreamFingerprint})
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, SystemFingerprint: "fp_gateway"}}
+	send := func() OpenAIChatResponse {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		var chatResp OpenAIChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&chatResp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return chatResp
+	}
+
+	if fp := send().SystemFingerprint; fp != "fp_gateway" {
+		t.Errorf("Expected the configured fingerprint, got %q", fp)
+	}
+	upstreamFingerprint = "fp_upstream"
+	if fp := send().SystemFingerprint; fp != "fp_upstream" {
+		t.Errorf("Expected the upstream fingerprint to take precedence, got %q", fp)
+	}
+
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+	for _, e := range readEvents(t, w.Result().Body) {
+		if e == streamDoneMarker {
+			continue
+		}
+		var chunk OpenAIChatChunk
+		if err := json.Unmarshal([]byte(e), &chunk); err != nil || chunk.SystemFingerprint != "fp_gateway" {
+			t.Errorf("Expected every chunk to carry the configured fingerprint, got %s", e)
+		}
+	}
+}
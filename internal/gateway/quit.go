@@ -1,6 +1,8 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,11 +16,107 @@ import (
 
 const (
 	quitTimeout = 5 * time.Second
+	// quitLivezPath is the liveness probe of the quit server.
+	quitLivezPath = "/livez"
+	// quitSignalMethods lists the methods accepted by /quitquitquit.
+	quitSignalMethods = "POST, OPTIONS"
+	// quitProbeMethods lists the methods accepted by the quit server probes.
+	quitProbeMethods = "GET, HEAD, OPTIONS"
 )
 
+// allowQuitProbe answers OPTIONS and rejects methods other than GET and HEAD
+// on a probe endpoint of the quit server, reporting whether r remains to be
+// served.
+func allowQuitProbe(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodOptions:
+		w.Header().Set("Allow", quitProbeMethods)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", quitProbeMethods)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+	return false
+}
+
+// handleQuitLivez reports that the gateway process is alive, so probes aimed
+// at the quit port get an answer without triggering a shutdown.
+func handleQuitLivez(w http.ResponseWriter, r *http.Request) {
+	if !allowQuitProbe(w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// handleQuitRoot answers the quit server root with the service status and any
+// other unregistered path with a 404 that points to the quit server endpoints.
+func handleQuitRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.Error(w, "Not found on the internal quit server, see "+quitLivezPath+" or /quitquitquit", http.StatusNotFound)
+		return
+	}
+	if !allowQuitProbe(w, r) {
+		return
+	}
+	handleServiceRoot(w, r)
+}
+
+// validateQuitPort checks that the quit server, when it listens on TCP, does not
+// share its port with the main server, which would otherwise make one of them
+// fail to bind in the background.
+func validateQuitPort(cfg *Config) error {
+	if cfg.DisableQuitServer || cfg.QuitSocket != "" || cfg.Port == 0 {
+		return nil
+	}
+	if cfg.Port == cfg.QuitPort {
+		return fmt.Errorf("--quit-port must differ from --port, both are %d", cfg.Port)
+	}
+	return nil
+}
+
+// listenQuit opens the listener of the quit server: addr on localhost TCP, or the
+// Unix domain socket at Config.QuitSocket when set. A stale socket left behind by
+// an unclean exit is replaced, and the new socket is only accessible by its owner.
+func listenQuit(cfg *Config, addr string) (net.Listener, error) {
+	if cfg.QuitSocket == "" {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Lstat(cfg.QuitSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(cfg.QuitSocket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale quit socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", cfg.QuitSocket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(cfg.QuitSocket, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict quit socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// isNotRunning reports whether err means no gateway is listening at the target.
+func isNotRunning(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var sysErr *os.SyscallError
+	if !errors.As(opErr.Err, &sysErr) {
+		return false
+	}
+	return sysErr.Err == syscall.ECONNREFUSED || sysErr.Err == syscall.ENOENT
+}
+
 // NewQuitCommand creates a new cobra command for sending the quit signal.
 func NewQuitCommand() *cobra.Command {
 	var quitPort int
+	var quitSocket string
 
 	cmd := &cobra.Command{
 		Use:   "quit",
@@ -27,11 +125,19 @@ func NewQuitCommand() *cobra.Command {
 			log := logger.FromContext(cmd.Context())
 
 			quitURL := fmt.Sprintf("http://127.0.0.1:%d/quitquitquit", quitPort)
-			log.Info("Sending shutdown signal", "url", quitURL)
-
 			client := &http.Client{
 				Timeout: quitTimeout,
 			}
+			if quitSocket != "" {
+				quitURL = "http://unix/quitquitquit"
+				client.Transport = &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var dialer net.Dialer
+						return dialer.DialContext(ctx, "unix", quitSocket)
+					},
+				}
+			}
+			log.Info("Sending shutdown signal", "url", quitURL, "socket", quitSocket)
 
 			req, err := http.NewRequest("POST", quitURL, nil)
 			if err != nil {
@@ -45,11 +151,9 @@ func NewQuitCommand() *cobra.Command {
 					log.Error(err, "Quit request timed out", "timeout", quitTimeout)
 					return fmt.Errorf("quit request timed out: %w", err)
 				}
-				if opErr, ok := err.(*net.OpError); ok {
-					if sysErr, ok := opErr.Err.(*os.SyscallError); ok && sysErr.Err == syscall.ECONNREFUSED {
-						log.Info("Gateway server not found or not running at target address", "target_url", quitURL)
-						return nil
-					}
+				if isNotRunning(err) {
+					log.Info("Gateway server not found or not running at target address", "target_url", quitURL)
+					return nil
 				}
 				log.Error(err, "Failed to send quit request")
 				return fmt.Errorf("failed to send quit request: %w", err)
@@ -68,6 +172,7 @@ func NewQuitCommand() *cobra.Command {
 	}
 
 	cmd.Flags().IntVar(&quitPort, "quit-port", 8081, "Internal port where the target gateway's quit server listens")
+	cmd.Flags().StringVar(&quitSocket, "quit-socket", "", "Unix domain socket where the target gateway's quit server listens, used instead of --quit-port")
 
 	return cmd
 }
@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// shortTempDir returns a temporary directory whose paths fit the Unix socket limit.
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "gw")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestQuitOverUnixSocket(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	socket := filepath.Join(shortTempDir(t), "quit.sock")
+	cfg := &Config{QuitSocket: socket}
+	stopChan := make(chan struct{})
+	var closeOnce sync.Once
+	_, quitSrv := setupServers(ctx, cfg, newHandler(cfg), stopChan, &closeOnce)
+	go runQuitServer(ctx, cfg, quitSrv)
+	defer quitSrv.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the quit socket %s", socket)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Failed to stat quit socket: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected quit socket permissions 0600, got %o", perm)
+	}
+
+	cmd := NewQuitCommand()
+	cmd.SetContext(ctx)
+	cmd.SetArgs([]string{"--quit-socket", socket})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected the quit command to succeed, got %v", err)
+	}
+
+	select {
+	case <-stopChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the quit signal to be received over the Unix socket")
+	}
+}
+
+func TestQuitOverUnixSocketNotRunning(t *testing.T) {
+	cmd := NewQuitCommand()
+	cmd.SetContext(logr.NewContext(context.Background(), logr.Discard()))
+	cmd.SetArgs([]string{"--quit-socket", filepath.Join(shortTempDir(t), "missing.sock")})
+	if err := cmd.Execute(); err != nil {
+		t.Errorf("Expected a missing socket to be treated as not running, got %v", err)
+	}
+}
+
+func TestProcessServeRejectsQuitPortCollision(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	port := findAvailablePort(t)
+	err := processServe(ctx, &Config{OpenWebUIURL: "http://localhost:8080", Port: port, QuitPort: port})
+	if err == nil || !strings.Contains(err.Error(), "--quit-port must differ from --port") {
+		t.Errorf("Expected startup to fail for colliding ports, got %v", err)
+	}
+
+	for _, cfg := range []*Config{
+		{Port: port, QuitPort: port, DisableQuitServer: true},
+		{Port: port, QuitPort: port, QuitSocket: "/tmp/gw.sock"},
+		{Port: port, QuitPort: port + 1},
+	} {
+		if err := validateQuitPort(cfg); err != nil {
+			t.Errorf("Expected no collision for %+v, got %v", cfg, err)
+		}
+	}
+}
+
+func TestQuitServerProbes(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{QuitPort: findAvailablePort(t)}
+	stopChan := make(chan struct{})
+	_, quitSrv := setupServers(ctx, cfg, &handler{Config: cfg}, stopChan, &sync.Once{})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/", http.StatusOK, ""},
+		{http.MethodOptions, "/", http.StatusNoContent, quitProbeMethods},
+		{http.MethodDelete, "/", http.StatusMethodNotAllowed, quitProbeMethods},
+		{http.MethodGet, "/livez", http.StatusOK, ""},
+		{http.MethodHead, "/livez", http.StatusOK, ""},
+		{http.MethodGet, "/unknown", http.StatusNotFound, ""},
+		{http.MethodOptions, "/quitquitquit", http.StatusNoContent, quitSignalMethods},
+		{http.MethodGet, "/quitquitquit", http.StatusMethodNotAllowed, quitSignalMethods},
+		{http.MethodHead, "/quitquitquit", http.StatusMethodNotAllowed, quitSignalMethods},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		quitSrv.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil).WithContext(ctx))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: Expected status code %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Expected Allow %q, got %q", tt.method, tt.path, tt.allow, got)
+		}
+	}
+	select {
+	case <-stopChan:
+		t.Errorf("Expected probes not to trigger a shutdown")
+	default:
+	}
+}
+
+func TestDisableQuitServer(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{Port: findAvailablePort(t), QuitPort: findAvailablePort(t), ShutdownTimeoutSec: 5, DisableQuitServer: true, Debug: true}
+	stopChan := make(chan struct{})
+	var closeOnce sync.Once
+	mainSrv, quitSrv := setupServers(ctx, cfg, newHandler(cfg), stopChan, &closeOnce)
+	if quitSrv != nil {
+		t.Fatalf("Expected no quit server when disabled")
+	}
+	startServers(ctx, cfg, mainSrv, quitSrv, stopChan, &closeOnce)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !isPortInUse(cfg.Port) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the main server to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if isPortInUse(cfg.QuitPort) {
+		t.Errorf("Expected quit port %d not to be bound when the quit server is disabled", cfg.QuitPort)
+	}
+
+	shutdownServers(ctx, cfg, mainSrv, quitSrv, &sync.Once{})
+	if isPortInUse(cfg.Port) {
+		t.Errorf("Expected the main server to be stopped")
+	}
+}
@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// timeoutHeader reports the request deadline to clients on an upstream timeout.
+const timeoutHeader = "X-Timeout-Ms"
+
+// maxRetryDelay caps the exponential backoff between upstream attempts.
+const maxRetryDelay = 30 * time.Second
+
+// upstreamRequestFunc builds a fresh upstream request for each attempt.
+type upstreamRequestFunc func(ctx context.Context) (*http.Request, error)
+
+// upstreamContext derives the context bounding an upstream exchange. Buffered
+// requests are bounded by Config.RequestTimeoutSec; streams are not, since they
+// are expected to outlive a typical request timeout.
+func (h *handler) upstreamContext(ctx context.Context, stream bool) (context.Context, context.CancelFunc) {
+	if stream || h.Config.RequestTimeoutSec <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(h.Config.RequestTimeoutSec)*time.Second)
+}
+
+// writeUpstreamTimeout answers with a 504 when the upstream exchange bounded by
+// ctx failed because its Config.RequestTimeoutSec budget ran out, surfacing the
+// deadline in timeoutHeader and in an OpenAI-style error. It reports whether a
+// response was written.
+func (h *handler) writeUpstreamTimeout(w http.ResponseWriter, ctx context.Context, err error) bool {
+	timeout := time.Duration(h.Config.RequestTimeoutSec) * time.Second
+	if timeout <= 0 || err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+	w.Header().Set(timeoutHeader, strconv.FormatInt(timeout.Milliseconds(), 10))
+	writeOpenAIError(w, http.StatusGatewayTimeout, "timeout_error", "upstream_timeout",
+		fmt.Sprintf("Open-WebUI did not respond within the request timeout of %dms", timeout.Milliseconds()))
+	return true
+}
+
+type chatCompletionKey struct{}
+
+// withChatCompletion marks ctx as the context of a chat completion, the only
+// upstream POST that Config.RetryOnEarlyClose retries.
+func withChatCompletion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, chatCompletionKey{}, true)
+}
+
+// isChatCompletion reports whether ctx was marked by withChatCompletion.
+func isChatCompletion(ctx context.Context) bool {
+	chat, _ := ctx.Value(chatCompletionKey{}).(bool)
+	return chat
+}
+
+// retryDelay returns the backoff before retry attempt+1, doubling backoff per
+// attempt up to maxRetryDelay. The shift is bounded so it cannot overflow.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	return min(backoff<<min(attempt, 16), maxRetryDelay)
+}
+
+// doUpstream sends the request built by newReq to Open-WebUI, retrying transient
+// failures with exponential backoff, subject to the method-aware policy of
+// isRetryable. Connection errors and retryable status codes are counted against
+// separate limits, see retryLimit. All attempts share the deadline of ctx: no
+// retry is started once ctx is done or when the remaining budget cannot cover the
+// backoff delay.
+func (h *handler) doUpstream(ctx context.Context, newReq upstreamRequestFunc) (*http.Response, error) {
+	log := logger.FromContext(ctx)
+	client := h.upstreamClient()
+	backoff := time.Duration(h.Config.RetryBackoffMs) * time.Millisecond
+
+	start := time.Now()
+	defer func() { requestInfoFrom(ctx).addUpstream(time.Since(start)) }()
+	var connRetries, statusRetries int
+	for attempt := 0; ; attempt++ {
+		var sent atomic.Bool
+		trace := &httptrace.ClientTrace{
+			WroteRequest: func(httptrace.WroteRequestInfo) { sent.Store(true) },
+		}
+		req, err := newReq(httptrace.WithClientTrace(ctx, trace))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		retries := &statusRetries
+		if err != nil {
+			retries = &connRetries
+		}
+		retryable := isRetryable(ctx, req.Method, sent.Load(), resp, err) ||
+			(h.Config.RetryOnEarlyClose && isChatCompletion(ctx) && ctx.Err() == nil && isEarlyClose(err))
+		if *retries >= h.retryLimit(err) || !retryable {
+			if err == nil {
+				h.latencies.observe(time.Since(start))
+				if attempt > 0 && resp.StatusCode < http.StatusBadRequest {
+					h.metrics.observeRetrySuccess()
+				}
+			}
+			return resp, err
+		}
+
+		delay := retryDelay(backoff, attempt)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			log.Info("Retry budget exhausted, giving up", "attempts", attempt+1)
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			log.Info("Retrying upstream request", "attempt", attempt+1, "status_code", resp.StatusCode, "delay_ms", delay.Milliseconds())
+		} else {
+			log.Info("Retrying upstream request", "attempt", attempt+1, "error", err.Error(), "delay_ms", delay.Milliseconds())
+		}
+
+		h.metrics.observeRetry(retryClass(resp))
+		*retries++
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryClass returns the metrics label of a retried attempt: the status class
+// of resp, such as 5xx, or "connection" when no response was received.
+func retryClass(resp *http.Response) string {
+	if resp == nil {
+		return "connection"
+	}
+	return fmt.Sprintf("%dxx", resp.StatusCode/100)
+}
+
+// retryLimit returns the maximum number of retries for the class of failure of
+// an attempt: Config.MaxConnRetries for a connection-level err and
+// Config.MaxStatusRetries for a response, each falling back to Config.MaxRetries
+// when unset.
+func (h *handler) retryLimit(err error) int {
+	limit := h.Config.MaxStatusRetries
+	if err != nil {
+		limit = h.Config.MaxConnRetries
+	}
+	if limit <= 0 {
+		return h.Config.MaxRetries
+	}
+	return limit
+}
+
+// isRetryable reports whether an upstream attempt failed transiently and can be
+// repeated safely. A POST, such as a chat completion, is only retried on a
+// connection-level error before the request was fully written, since the upstream
+// may already be processing it otherwise. Other methods are idempotent forwards and
+// are also retried after connection errors and 502, 503 or 504 responses.
+func isRetryable(ctx context.Context, method string, sent bool, resp *http.Response, err error) bool {
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		return method != http.MethodPost || !sent
+	}
+	if method == http.MethodPost {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func newRetryChatRequest(t *testing.T) *http.Request {
+	t.Helper()
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	return req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+}
+
+func newRetryModelsRequest() *http.Request {
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	return req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+}
+
+func TestDoUpstreamRetriesTransientFailures(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 3, RetryBackoffMs: 1}}
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, newRetryModelsRequest())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d after retries, got %d", http.StatusOK, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("Expected 3 upstream attempts, got %d", n)
+	}
+}
+
+func TestDoUpstreamNoRetryOnClientError(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 3, RetryBackoffMs: 1}}
+	h.handleChatCompletions(httptest.NewRecorder(), newRetryChatRequest(t))
+
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("Expected a single upstream attempt for a non-transient error, got %d", n)
+	}
+}
+
+func TestDoUpstreamRetryBudgetExhausted(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// Backoff delays of 100, 200, 400 and 800ms cannot all fit into a 1s budget.
+	maxRetries := 5
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: maxRetries, RetryBackoffMs: 100, RequestTimeoutSec: 1}}
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, newRetryModelsRequest())
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	n := atomic.LoadInt32(&attempts)
+	if n < 2 || int(n) >= maxRetries+1 {
+		t.Errorf("Expected retries to stop early when the budget is exhausted, got %d attempts", n)
+	}
+	if elapsed > 1200*time.Millisecond {
+		t.Errorf("Expected retries to stay within the 1s request budget, took %v", elapsed)
+	}
+}
+
+func TestDoUpstreamNoRetryForPostAfterResponse(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		var attempts int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(status)
+		}))
+
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 3, RetryBackoffMs: 1}}
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, newRetryChatRequest(t))
+		ts.Close()
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected status code %d for upstream %d, got %d", http.StatusBadGateway, status, w.Code)
+		}
+		if n := atomic.LoadInt32(&attempts); n != 1 {
+			t.Errorf("Expected a POST not to be retried after a %d, got %d attempts", status, n)
+		}
+	}
+}
+
+func TestDoUpstreamNoRetryForPostAfterRequestSent(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		io.ReadAll(r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		// Drop the connection after the upstream received the whole body.
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 3, RetryBackoffMs: 1}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newRetryChatRequest(t))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("Expected a POST not to be retried once the upstream received it, got %d attempts", n)
+	}
+}
+
+func TestDoUpstreamNoEarlyCloseRetryForForwardedPost(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		io.ReadAll(r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 3, RetryBackoffMs: 1, RetryOnEarlyClose: true}}
+	req := httptest.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(`{"model": "test-model", "input": "Hello"}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("Expected a forwarded POST not to be retried with RetryOnEarlyClose, got %d attempts", n)
+	}
+}
+
+func TestDoUpstreamStatusRetryLimit(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 5, MaxStatusRetries: 2, RetryBackoffMs: 1}}
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, newRetryModelsRequest())
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("Expected 3 upstream attempts with a status retry limit of 2, got %d", n)
+	}
+}
+
+func TestDoUpstreamConnRetryLimit(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxRetries: 5, MaxConnRetries: 1, RetryBackoffMs: 1}}
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, newRetryModelsRequest())
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("Expected 2 upstream attempts with a connection retry limit of 1, got %d", n)
+	}
+}
+
+func TestDoUpstreamRetryLimitsPerClass(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Alternate between dropped connections and 503 responses.
+		if atomic.AddInt32(&attempts, 1)%2 == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Failed to hijack connection: %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// Two connection errors and one 503 are retried; the second 503 is not.
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxConnRetries: 2, MaxStatusRetries: 1, RetryBackoffMs: 1}}
+	w := httptest.NewRecorder()
+	h.forwardAndTransform(w, newRetryModelsRequest())
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 4 {
+		t.Errorf("Expected 4 upstream attempts, got %d", n)
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	connErr := errors.New("connection refused")
+	tests := []struct {
+		name string
+		cfg  Config
+		err  error
+		want int
+	}{
+		{"status inherits", Config{MaxRetries: 3}, nil, 3},
+		{"conn inherits", Config{MaxRetries: 3}, connErr, 3},
+		{"status override", Config{MaxRetries: 3, MaxStatusRetries: 5}, nil, 5},
+		{"conn override", Config{MaxRetries: 3, MaxConnRetries: 1}, connErr, 1},
+		{"conn override leaves status", Config{MaxRetries: 3, MaxConnRetries: 1}, nil, 3},
+	}
+	for _, tt := range tests {
+		h := &handler{Config: &tt.cfg}
+		if got := h.retryLimit(tt.err); got != tt.want {
+			t.Errorf("%s: retryLimit() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := 200 * time.Millisecond
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 200 * time.Millisecond},
+		{3, 1600 * time.Millisecond},
+		{20, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(backoff, tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%v, %d) = %v, want %v", backoff, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	ctx := context.Background()
+	connErr := errors.New("connection refused")
+	tests := []struct {
+		name   string
+		method string
+		sent   bool
+		status int
+		err    error
+		want   bool
+	}{
+		{"POST connection error before send", http.MethodPost, false, 0, connErr, true},
+		{"POST connection error after send", http.MethodPost, true, 0, connErr, false},
+		{"POST 503", http.MethodPost, true, http.StatusServiceUnavailable, nil, false},
+		{"GET connection error after send", http.MethodGet, true, 0, connErr, true},
+		{"GET 502", http.MethodGet, true, http.StatusBadGateway, nil, true},
+		{"GET 503", http.MethodGet, true, http.StatusServiceUnavailable, nil, true},
+		{"GET 500", http.MethodGet, true, http.StatusInternalServerError, nil, false},
+	}
+	for _, tt := range tests {
+		var resp *http.Response
+		if tt.err == nil {
+			resp = &http.Response{StatusCode: tt.status}
+		}
+		if got := isRetryable(ctx, tt.method, tt.sent, resp, tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamTimeoutResponse(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, RequestTimeoutSec: 1}}
+	tests := []struct {
+		name   string
+		handle http.HandlerFunc
+		req    *http.Request
+	}{
+		{"chat completion", h.handleChatCompletions, newRetryChatRequest(t)},
+		{"forward", h.forwardAndTransform, newRetryModelsRequest()},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handle(w, tt.req)
+
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusGatewayTimeout, w.Code)
+		}
+		if got := w.Header().Get(timeoutHeader); got != "1000" {
+			t.Errorf("%s: Expected %s 1000, got %q", tt.name, timeoutHeader, got)
+		}
+		var errResp OpenAIErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+			t.Fatalf("%s: Failed to decode error response %q: %v", tt.name, w.Body.String(), err)
+		}
+		if errResp.Error.Code != "upstream_timeout" || !strings.Contains(errResp.Error.Message, "1000ms") {
+			t.Errorf("%s: Expected an upstream_timeout error naming the deadline, got %+v", tt.name, errResp.Error)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// Logical routes of the main server. They identify the handler serving a
+// request in logs and metrics, independently of the exact path.
+const (
+	routeServiceRoot      = "root"
+	routeCapabilities     = "capabilities"
+	routeChatCompletions  = "chat_completions"
+	routeModels           = "models"
+	routeMessages         = "messages"
+	routeHealth           = "health"
+	routeForward          = "forward"
+	routeOptions          = "options"
+	routeMethodNotAllowed = "method_not_allowed"
+)
+
+// healthPath is the path of the gateway health check.
+const healthPath = "/healthz"
+
+type routeKey struct{}
+
+// matchRoute returns the logical route of r.
+func (h *handler) matchRoute(r *http.Request) string {
+	if r.URL.Path == healthPath {
+		return routeHealth
+	}
+	if r.Method == http.MethodOptions {
+		return routeOptions
+	}
+	if r.Method == http.MethodHead && h.Config.ForwardHead {
+		// HEAD requests are passed through to Open-WebUI, except for the
+		// gateway's own service root.
+		if r.URL.Path == "/" {
+			return routeServiceRoot
+		}
+		return routeForward
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		return routeMethodNotAllowed
+	}
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		return routeServiceRoot
+	case r.URL.Path == capabilitiesPath:
+		return routeCapabilities
+	case r.URL.Path == "/v1/chat/completions":
+		return routeChatCompletions
+	case r.URL.Path == modelsPath && r.Method == http.MethodGet:
+		return routeModels
+	case r.URL.Path == anthropicMessagesPath && r.Method == http.MethodPost:
+		return routeMessages
+	}
+	return routeForward
+}
+
+// routeFrom returns the route matched by withRoute for r, matching it if r did
+// not pass through withRoute.
+func (h *handler) routeFrom(r *http.Request) string {
+	if route, ok := r.Context().Value(routeKey{}).(string); ok {
+		return route
+	}
+	return h.matchRoute(r)
+}
+
+// withRoute is a middleware that matches the route of a request once, adds it
+// as the "route" field of the request logger and counts the response per route
+// in the requests metric. Handlers dispatch on routeFrom instead of inspecting
+// the path again.
+func (h *handler) withRoute(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := h.matchRoute(r)
+		ctx := context.WithValue(r.Context(), routeKey{}, route)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithValues("route", route))
+		r = r.WithContext(ctx)
+		if h.metrics == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status := http.StatusOK
+		hw := &hookWriter{ResponseWriter: w, onWriteHeader: func(_ http.Header, code int) int {
+			status = code
+			return code
+		}}
+		next.ServeHTTP(hw, r)
+		h.metrics.observeRequest(route, status)
+	}
+}
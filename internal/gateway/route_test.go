@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRouteLabel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/chat":
+			w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+		case "/v1/models":
+			w.Write([]byte(`{"object": "list", "data": []}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, args)
+	}, funcr.Options{})
+	ctx := logr.NewContext(context.Background(), log)
+	cfg := &Config{OpenWebUIURL: upstream.URL, Metrics: true, ForwardHead: true}
+	h := newHandler(cfg)
+	mainSrv, _ := setupServers(ctx, cfg, h, make(chan struct{}), &sync.Once{})
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		route  string
+		code   string
+	}{
+		{http.MethodPost, "/v1/chat/completions", `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`, routeChatCompletions, "200"},
+		{http.MethodGet, "/v1/models", "", routeModels, "200"},
+		{http.MethodGet, "/v1/embeddings", "", routeForward, "200"},
+		{http.MethodGet, "/v1/capabilities", "", routeCapabilities, "200"},
+		{http.MethodGet, "/", "", routeServiceRoot, "200"},
+		{http.MethodHead, "/", "", routeServiceRoot, "200"},
+		{http.MethodHead, "/v1/models", "", routeForward, "200"},
+		{http.MethodGet, "/healthz", "", routeHealth, "200"},
+		{http.MethodOptions, "/v1/chat/completions", "", routeOptions, "204"},
+		{http.MethodDelete, "/v1/models", "", routeMethodNotAllowed, "405"},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		logs = nil
+		mu.Unlock()
+		before := testutil.ToFloat64(h.metrics.requests.WithLabelValues(tt.route, tt.code))
+		w := httptest.NewRecorder()
+		mainSrv.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+
+		if v := testutil.ToFloat64(h.metrics.requests.WithLabelValues(tt.route, tt.code)) - before; v != 1 {
+			t.Errorf("%s %s: Expected one request counted for route %s and code %s, got %v (status %d)", tt.method, tt.path, tt.route, tt.code, v, w.Code)
+		}
+		mu.Lock()
+		for _, line := range logs {
+			if !strings.Contains(line, `"route"="`+tt.route+`"`) {
+				t.Errorf("%s %s: Expected every log line to carry route %s, got %s", tt.method, tt.path, tt.route, line)
+			}
+		}
+		mu.Unlock()
+	}
+}
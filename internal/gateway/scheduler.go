@@ -0,0 +1,279 @@
+package gateway
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// priority is the scheduling class of a request, see priorityHeader.
+type priority int
+
+const (
+	priorityLow priority = iota
+	priorityNormal
+	priorityHigh
+)
+
+// priorityHeader lets clients choose the scheduling class of a request.
+const priorityHeader = "X-Priority"
+
+// parsePriority maps an X-Priority header value to a priority; empty or
+// unknown values are treated as normal.
+func parsePriority(value string) priority {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low":
+		return priorityLow
+	case "high":
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+// scheduler limits the number of concurrent upstream requests. When fair
+// scheduling is enabled, freed slots are handed out round-robin across client
+// keys so that a single client flooding the gateway cannot starve the others.
+// High priority requests jump ahead of queued normal and low priority requests
+// while they hold fewer than highSlots of the slots.
+type scheduler struct {
+	mu         sync.Mutex
+	capacity   int
+	highSlots  int
+	active     int
+	activeHigh int
+	fair       bool
+	queues     [priorityHigh + 1]keyQueue
+}
+
+// waiter is a request queued for an upstream slot.
+type waiter struct {
+	key     string
+	prio    priority
+	ready   chan struct{}
+	granted bool
+}
+
+// keyQueue holds waiters in per-key FIFO queues that are served round-robin.
+type keyQueue struct {
+	queues map[string][]*waiter
+	order  []string
+	next   int
+}
+
+func (q *keyQueue) len() int {
+	n := 0
+	for _, queue := range q.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+func (q *keyQueue) push(wt *waiter) {
+	if q.queues == nil {
+		q.queues = make(map[string][]*waiter)
+	}
+	if _, ok := q.queues[wt.key]; !ok {
+		q.order = append(q.order, wt.key)
+	}
+	q.queues[wt.key] = append(q.queues[wt.key], wt)
+}
+
+// pop removes the next waiter in round-robin order, or returns nil.
+func (q *keyQueue) pop() *waiter {
+	if len(q.order) == 0 {
+		return nil
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+	key := q.order[q.next]
+	queue := q.queues[key]
+	wt := queue[0]
+	if len(queue) == 1 {
+		delete(q.queues, key)
+		q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+	} else {
+		q.queues[key] = queue[1:]
+		q.next++
+	}
+	return wt
+}
+
+func (q *keyQueue) remove(wt *waiter) {
+	queue := q.queues[wt.key]
+	for i, w := range queue {
+		if w != wt {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		break
+	}
+	if len(queue) > 0 {
+		q.queues[wt.key] = queue
+		return
+	}
+	delete(q.queues, wt.key)
+	for i, k := range q.order {
+		if k != wt.key {
+			continue
+		}
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		if q.next > i {
+			q.next--
+		}
+		break
+	}
+}
+
+// newScheduler creates a scheduler allowing capacity concurrent requests, of
+// which highFraction may be taken by high priority requests jumping the queue.
+func newScheduler(capacity int, fair bool, highFraction float64) *scheduler {
+	return &scheduler{
+		capacity:  capacity,
+		highSlots: int(math.Ceil(highFraction * float64(capacity))),
+		fair:      fair,
+	}
+}
+
+// acquire blocks until an upstream slot is available for key or ctx is done.
+func (s *scheduler) acquire(ctx context.Context, key string, prio priority) error {
+	if !s.fair {
+		key = ""
+	}
+
+	s.mu.Lock()
+	wt := &waiter{key: key, prio: prio, ready: make(chan struct{})}
+	if s.active < s.capacity && s.waitingLocked() == 0 {
+		s.grantLocked(wt)
+		s.mu.Unlock()
+		return nil
+	}
+	s.queues[prio].push(wt)
+	s.mu.Unlock()
+
+	select {
+	case <-wt.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if wt.granted {
+			// The slot was handed over while giving up; pass it on.
+			s.releaseLocked(prio)
+			return ctx.Err()
+		}
+		s.queues[prio].remove(wt)
+		return ctx.Err()
+	}
+}
+
+// tryAcquire takes a normal priority upstream slot if one is free and no
+// request is queued for it, without waiting.
+func (s *scheduler) tryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active >= s.capacity || s.waitingLocked() > 0 {
+		return false
+	}
+	s.grantLocked(&waiter{prio: priorityNormal})
+	return true
+}
+
+// release returns a slot held at prio, handing it to the next queued request.
+func (s *scheduler) release(prio priority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked(prio)
+}
+
+func (s *scheduler) releaseLocked(prio priority) {
+	s.active--
+	if prio == priorityHigh {
+		s.activeHigh--
+	}
+	if wt := s.nextLocked(); wt != nil {
+		s.grantLocked(wt)
+		close(wt.ready)
+	}
+}
+
+// nextLocked picks the next waiter to serve. High priority requests go first
+// while below their slot share, then normal, then remaining high, then low.
+func (s *scheduler) nextLocked() *waiter {
+	if s.activeHigh < s.highSlots {
+		if wt := s.queues[priorityHigh].pop(); wt != nil {
+			return wt
+		}
+	}
+	for _, prio := range []priority{priorityNormal, priorityHigh, priorityLow} {
+		if wt := s.queues[prio].pop(); wt != nil {
+			return wt
+		}
+	}
+	return nil
+}
+
+func (s *scheduler) grantLocked(wt *waiter) {
+	wt.granted = true
+	s.active++
+	if wt.prio == priorityHigh {
+		s.activeHigh++
+	}
+}
+
+func (s *scheduler) waitingLocked() int {
+	n := 0
+	for i := range s.queues {
+		n += s.queues[i].len()
+	}
+	return n
+}
+
+// waiting returns the number of queued requests.
+func (s *scheduler) waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waitingLocked()
+}
+
+// withConcurrencyLimit is a middleware that holds an upstream slot for the
+// duration of the request when a concurrency limit is configured.
+func (h *handler) withConcurrencyLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.scheduler == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		prio := parsePriority(r.Header.Get(priorityHeader))
+		if err := h.scheduler.acquire(r.Context(), clientKey(r), prio); err != nil {
+			logger.FromContext(r.Context()).Info("Request abandoned while waiting for an upstream slot", "error", err.Error())
+			return
+		}
+		defer h.scheduler.release(prio)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// clientKey identifies the client of a request for fair scheduling. The
+// Authorization header is preferred so that clients behind a shared address
+// are still told apart; otherwise the client IP is used.
+func clientKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return "auth:" + auth
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the IP address of the remote peer of a request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,245 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// waitForQueued polls until n requests are queued on s.
+func waitForQueued(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.waiting() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for %d queued requests, got %d", n, s.waiting())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// runSchedule holds the only slot, queues floodCount requests for "flood" and
+// one for "other", then releases slots one by one and returns the grant order.
+func runSchedule(t *testing.T, fair bool, floodCount int) []string {
+	t.Helper()
+	s := newScheduler(1, fair, 0)
+	ctx := context.Background()
+	if err := s.acquire(ctx, "flood", priorityNormal); err != nil {
+		t.Fatalf("Failed to acquire initial slot: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	granted := make(chan struct{})
+	enqueue := func(key string) {
+		go func() {
+			if err := s.acquire(ctx, key, priorityNormal); err != nil {
+				t.Errorf("Failed to acquire slot: %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, key)
+			mu.Unlock()
+			granted <- struct{}{}
+		}()
+	}
+
+	for i := 0; i < floodCount; i++ {
+		enqueue("flood")
+		waitForQueued(t, s, i+1)
+	}
+	enqueue("other")
+	waitForQueued(t, s, floodCount+1)
+
+	for i := 0; i <= floodCount; i++ {
+		s.release(priorityNormal)
+		select {
+		case <-granted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for a queued request to be granted")
+		}
+	}
+	s.release(priorityNormal)
+	return order
+}
+
+func TestSchedulerFairQueue(t *testing.T) {
+	order := runSchedule(t, true, 5)
+	if len(order) != 6 {
+		t.Fatalf("Expected 6 grants, got %d", len(order))
+	}
+	// The flooding client already has a queued request ahead of the other
+	// client, but round-robin must serve the other client immediately after.
+	if order[1] != "other" {
+		t.Errorf("Expected other client to be served second with fair queue, got order %v", order)
+	}
+}
+
+func TestSchedulerFIFOWithoutFairQueue(t *testing.T) {
+	order := runSchedule(t, false, 5)
+	if order[len(order)-1] != "other" {
+		t.Errorf("Expected other client to be served last without fair queue, got order %v", order)
+	}
+}
+
+func TestSchedulerAcquireCanceled(t *testing.T) {
+	s := newScheduler(1, true, 0)
+	if err := s.acquire(context.Background(), "a", priorityNormal); err != nil {
+		t.Fatalf("Failed to acquire initial slot: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() { errChan <- s.acquire(ctx, "b", priorityNormal) }()
+	waitForQueued(t, s, 1)
+	cancel()
+
+	if err := <-errChan; err == nil {
+		t.Errorf("Expected an error when the context is canceled while queued")
+	}
+	if n := s.waiting(); n != 0 {
+		t.Errorf("Expected canceled request to leave the queue, got %d queued", n)
+	}
+
+	s.release(priorityNormal)
+	if err := s.acquire(context.Background(), "c", priorityNormal); err != nil {
+		t.Errorf("Expected slot to be available after release, got %v", err)
+	}
+}
+
+func TestWithConcurrencyLimit(t *testing.T) {
+	h := newHandler(&Config{MaxConcurrency: 1, FairQueue: true})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	limited := h.withConcurrencyLimit(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active--
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/v1/models", nil)
+			req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+			limited(httptest.NewRecorder(), req)
+		}()
+	}
+	waitForQueued(t, h.scheduler, 2)
+	close(release)
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("Expected at most 1 concurrent request, got %d", maxActive)
+	}
+}
+
+// queueWaiter queues an acquire on s and reports its name on granted once served.
+func queueWaiter(t *testing.T, s *scheduler, name string, prio priority, granted chan<- string) {
+	t.Helper()
+	n := s.waiting()
+	go func() {
+		if err := s.acquire(context.Background(), name, prio); err != nil {
+			t.Errorf("Failed to acquire slot: %v", err)
+			return
+		}
+		granted <- name
+	}()
+	waitForQueued(t, s, n+1)
+}
+
+func nextGranted(t *testing.T, granted <-chan string) string {
+	t.Helper()
+	select {
+	case name := <-granted:
+		return name
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for a queued request to be granted")
+	}
+	return ""
+}
+
+func TestSchedulerHighPriorityJumpsQueue(t *testing.T) {
+	s := newScheduler(1, false, 1)
+	if err := s.acquire(context.Background(), "holder", priorityNormal); err != nil {
+		t.Fatalf("Failed to acquire initial slot: %v", err)
+	}
+
+	granted := make(chan string, 4)
+	queueWaiter(t, s, "normal-1", priorityNormal, granted)
+	queueWaiter(t, s, "normal-2", priorityNormal, granted)
+	queueWaiter(t, s, "low", priorityLow, granted)
+	queueWaiter(t, s, "high", priorityHigh, granted)
+
+	s.release(priorityNormal)
+	if name := nextGranted(t, granted); name != "high" {
+		t.Errorf("Expected high priority request to be served first, got %s", name)
+	}
+	s.release(priorityHigh)
+	if name := nextGranted(t, granted); name != "normal-1" {
+		t.Errorf("Expected normal-1 to be served next, got %s", name)
+	}
+	s.release(priorityNormal)
+	if name := nextGranted(t, granted); name != "normal-2" {
+		t.Errorf("Expected normal-2 to be served next, got %s", name)
+	}
+	s.release(priorityNormal)
+	if name := nextGranted(t, granted); name != "low" {
+		t.Errorf("Expected low priority request to be served last, got %s", name)
+	}
+}
+
+func TestSchedulerHighPrioritySlotShare(t *testing.T) {
+	// With 2 slots and a 0.5 share only one high priority request may jump ahead.
+	s := newScheduler(2, false, 0.5)
+	for i := 0; i < 2; i++ {
+		if err := s.acquire(context.Background(), "holder", priorityNormal); err != nil {
+			t.Fatalf("Failed to acquire initial slot: %v", err)
+		}
+	}
+
+	granted := make(chan string, 3)
+	queueWaiter(t, s, "normal", priorityNormal, granted)
+	queueWaiter(t, s, "high-1", priorityHigh, granted)
+	queueWaiter(t, s, "high-2", priorityHigh, granted)
+
+	s.release(priorityNormal)
+	if name := nextGranted(t, granted); name != "high-1" {
+		t.Errorf("Expected high-1 to jump the queue, got %s", name)
+	}
+	s.release(priorityNormal)
+	if name := nextGranted(t, granted); name != "normal" {
+		t.Errorf("Expected normal to be served once the high priority share is used, got %s", name)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := map[string]priority{
+		"":        priorityNormal,
+		"normal":  priorityNormal,
+		"HIGH":    priorityHigh,
+		" low ":   priorityLow,
+		"urgent!": priorityNormal,
+	}
+	for value, want := range tests {
+		if got := parsePriority(value); got != want {
+			t.Errorf("parsePriority(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultSelftestModel is the model used by the canned selftest chat completion.
+	defaultSelftestModel = "selftest"
+	// selftestTimeout bounds each selftest request.
+	selftestTimeout = 30 * time.Second
+)
+
+// selftestCheck is a single request run by the selftest command.
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context, client *http.Client, baseURL string) error
+}
+
+// NewSelftestCommand creates a hidden cobra command that runs the gateway against
+// an upstream and checks that a chat completion and a models listing succeed.
+func NewSelftestCommand() *cobra.Command {
+	var openWebUIURL string
+	var openWebUIAPIKey string
+	var model string
+
+	cmd := &cobra.Command{
+		Use:    "selftest",
+		Short:  "Runs a canned chat completion and models listing against an upstream",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := &Config{
+				OpenWebUIURL:           openWebUIURL,
+				OpenWebUIAPIKey:        openWebUIAPIKey,
+				DialTimeoutSec:         defaultDialTimeoutSec,
+				RetryBackoffMs:         defaultRetryBackoffMs,
+				UpstreamResponseFormat: upstreamFormatAuto,
+			}
+			return runSelftest(cmd.Context(), cmd.OutOrStdout(), cfg, model)
+		},
+	}
+
+	cmd.Flags().StringVar(&openWebUIURL, "open-webui-url", os.Getenv("OPEN_WEBUI_URL"), "Open-WebUI API endpoint URL to test against (can also be set via OPEN_WEBUI_URL env var)")
+	cmd.Flags().StringVar(&openWebUIAPIKey, "open-webui-api-key", os.Getenv("OPEN_WEBUI_API_KEY"), "API key sent to Open-WebUI (can also be set via OPEN_WEBUI_API_KEY env var)")
+	cmd.Flags().StringVar(&model, "model", defaultSelftestModel, "Model used for the canned chat completion")
+
+	return cmd
+}
+
+// runSelftest serves the gateway on a loopback listener, see serveLoopback, runs
+// each check through it and reports the results to out. An error is returned if
+// the gateway could not be started or any check failed.
+func runSelftest(ctx context.Context, out io.Writer, cfg *Config, model string) error {
+	if cfg.OpenWebUIURL == "" {
+		return fmt.Errorf("--open-webui-url is required")
+	}
+	if err := validateOpenWebUIURL(cfg.OpenWebUIURL); err != nil {
+		return err
+	}
+
+	baseURL, stop, err := serveLoopback(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	client := &http.Client{Timeout: selftestTimeout}
+	checks := []selftestCheck{
+		{name: "chat completion", run: func(ctx context.Context, client *http.Client, baseURL string) error {
+			return selftestChatCompletion(ctx, client, baseURL, model)
+		}},
+		{name: "models listing", run: selftestModels},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		if err := check.run(ctx, client, baseURL); err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Fprintf(out, "PASS %s\n", check.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("selftest failed: %d of %d checks failed", failed, len(checks))
+	}
+	fmt.Fprintln(out, "selftest passed")
+	return nil
+}
+
+// serveLoopback serves the gateway on a loopback listener using the same server
+// setup as the serve command and returns its base URL. stop shuts it down.
+func serveLoopback(ctx context.Context, cfg *Config) (baseURL string, stop func(), err error) {
+	log := logger.FromContext(ctx)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start loopback listener: %w", err)
+	}
+	var closeOnce sync.Once
+	mainSrv, _ := setupServers(ctx, cfg, newHandler(cfg), make(chan struct{}), &closeOnce)
+	go func() {
+		if err := mainSrv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error(err, "Loopback server error")
+		}
+	}()
+	return "http://" + listener.Addr().String(), func() { mainSrv.Close() }, nil
+}
+
+// selftestChatCompletion sends a canned chat completion and checks that an
+// OpenAI compatible response with an assistant message comes back.
+func selftestChatCompletion(ctx context.Context, client *http.Client, baseURL, model string) error {
+	reqBody, err := json.Marshal(OpenAIChatRequest{
+		Model:    model,
+		Messages: []MessageItem{{Role: "user", Content: "Reply with OK."}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/v1/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var chatResp OpenAIChatResponse
+	if err := selftestDo(client, req, &chatResp); err != nil {
+		return err
+	}
+	if chatResp.Object != "chat.completion" {
+		return fmt.Errorf("unexpected object %q", chatResp.Object)
+	}
+	if len(chatResp.Choices) == 0 || chatResp.Choices[0].Message.isEmpty() {
+		return fmt.Errorf("response contains no message")
+	}
+	return nil
+}
+
+// selftestModels lists the models and checks that a JSON document comes back.
+func selftestModels(ctx context.Context, client *http.Client, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	var models json.RawMessage
+	return selftestDo(client, req, &models)
+}
+
+// selftestDo sends req and decodes a 200 OK JSON response into v.
+func selftestDo(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid JSON response: %w", err)
+	}
+	return nil
+}
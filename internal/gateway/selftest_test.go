@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSelftestCommand(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/chat":
+			json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "OK"}})
+		case "/models":
+			fmt.Fprint(w, `{"data": [{"id": "selftest"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	cmd := NewSelftestCommand()
+	cmd.SetContext(logr.NewContext(context.Background(), logr.Discard()))
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--open-webui-url", upstream.URL})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected selftest to succeed, got %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"PASS chat completion", "PASS models listing", "selftest passed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestSelftestCommandFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	var out bytes.Buffer
+	cmd := NewSelftestCommand()
+	cmd.SetContext(logr.NewContext(context.Background(), logr.Discard()))
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"--open-webui-url", upstream.URL})
+	if err := cmd.Execute(); err == nil {
+		t.Fatalf("Expected selftest to fail against an unavailable upstream")
+	}
+	if !strings.Contains(out.String(), "FAIL chat completion") {
+		t.Errorf("Expected a failed chat completion check, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+type requestInfoKey struct{}
+
+// requestInfo collects details about a request while it is handled, for the
+// slow-request log written once it completes.
+type requestInfo struct {
+	mu       sync.Mutex
+	model    string
+	upstream time.Duration
+}
+
+// requestInfoFrom returns the requestInfo of ctx, or nil if there is none.
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// setModel records the model of the request. It is a no-op on a nil requestInfo.
+func (i *requestInfo) setModel(model string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.model = model
+}
+
+// addUpstream adds time spent waiting on Open-WebUI. It is a no-op on a nil requestInfo.
+func (i *requestInfo) addUpstream(d time.Duration) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.upstream += d
+}
+
+// withSlowRequestLog is a middleware that logs a warning for every request
+// taking longer than Config.SlowRequestThresholdMs, regardless of sampling or
+// verbosity, so performance regressions stand out.
+func (h *handler) withSlowRequestLog(next http.HandlerFunc) http.HandlerFunc {
+	threshold := time.Duration(h.Config.SlowRequestThresholdMs) * time.Millisecond
+	if threshold <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		duration := time.Since(start)
+		if duration <= threshold {
+			return
+		}
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		logger.FromContext(r.Context()).Info("Warning: slow request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"model", info.model,
+			"duration_ms", duration.Milliseconds(),
+			"upstream_duration_ms", info.upstream.Milliseconds(),
+			"threshold_ms", threshold.Milliseconds(),
+		)
+	}
+}
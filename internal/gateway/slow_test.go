@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestSlowRequestLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chatReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&chatReq)
+		if chatReq.Model == "slow-model" {
+			time.Sleep(150 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, args)
+	}, funcr.Options{})
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, SlowRequestThresholdMs: 100}}
+	ts := httptest.NewServer(wrapLogger(log, h.withSlowRequestLog(h.handleRoot)))
+	defer ts.Close()
+
+	slowWarnings := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var warnings []string
+		for _, line := range logs {
+			if strings.Contains(line, "slow request") {
+				warnings = append(warnings, line)
+			}
+		}
+		return warnings
+	}
+
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if warnings := slowWarnings(); len(warnings) != 0 {
+		t.Errorf("Expected no slow-request warning for a fast request, got %v", warnings)
+	}
+
+	body = `{"model": "slow-model", "messages": [{"role": "user", "content": "Hello"}]}`
+	resp, err = http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+
+	warnings := slowWarnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expected one slow-request warning, got %v", warnings)
+	}
+	for _, want := range []string{`"path"="/v1/chat/completions"`, `"model"="slow-model"`, `"threshold_ms"=100`} {
+		if !strings.Contains(warnings[0], want) {
+			t.Errorf("Expected the warning to contain %s, got %s", want, warnings[0])
+		}
+	}
+	m := regexp.MustCompile(`"upstream_duration_ms"=(\d+)`).FindStringSubmatch(warnings[0])
+	if m == nil {
+		t.Fatalf("Expected the warning to report the upstream duration, got %s", warnings[0])
+	}
+	if ms, _ := strconv.Atoi(m[1]); ms < 150 {
+		t.Errorf("Expected an upstream duration of at least 150ms, got %dms", ms)
+	}
+}
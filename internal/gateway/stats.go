@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// latencyWindowSize is the number of most recent upstream latencies kept for /debug/stats.
+const latencyWindowSize = 1024
+
+// latencyWindow is a concurrency-safe ring buffer of the most recent upstream latencies.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+// observe records a latency, replacing the oldest sample once the window is full.
+// It is a no-op on a nil window.
+func (l *latencyWindow) observe(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.next] = d
+	l.next++
+	if l.next == len(l.samples) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// snapshot returns a sorted copy of the samples in the window.
+func (l *latencyWindow) snapshot() []time.Duration {
+	l.mu.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, l.samples[:n])
+	l.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// latencyStats is the /debug/stats response.
+type latencyStats struct {
+	Count  int     `json:"count"`
+	Window int     `json:"window"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+}
+
+func (l *latencyWindow) stats() latencyStats {
+	sorted := l.snapshot()
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return latencyStats{
+		Count:  len(sorted),
+		Window: len(l.samples),
+		P50Ms:  ms(percentile(sorted, 50)),
+		P95Ms:  ms(percentile(sorted, 95)),
+		P99Ms:  ms(percentile(sorted, 99)),
+	}
+}
+
+// handleDebugStats reports rolling upstream latency percentiles.
+func (h *handler) handleDebugStats(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.latencies.stats()); err != nil {
+		log.Error(err, "Failed to encode debug stats")
+	}
+}
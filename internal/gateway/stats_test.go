@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestDebugStatsPercentiles(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	cfg := &Config{QuitPort: findAvailablePort(t), Debug: true}
+	h := newHandler(cfg)
+	var closeOnce sync.Once
+	_, quitSrv := setupServers(ctx, cfg, h, make(chan struct{}), &closeOnce)
+
+	// Latencies of 1..1000ms in random order from concurrent observers.
+	latencies := rand.Perm(1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(part []int) {
+			defer wg.Done()
+			for _, ms := range part {
+				h.latencies.observe(time.Duration(ms+1) * time.Millisecond)
+			}
+		}(latencies[i*250 : (i+1)*250])
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	quitSrv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/stats", nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var stats latencyStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode stats %q: %v", w.Body.String(), err)
+	}
+
+	if stats.Count != 1000 {
+		t.Errorf("Expected 1000 samples, got %d", stats.Count)
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", stats.P50Ms, 500},
+		{"p95", stats.P95Ms, 950},
+		{"p99", stats.P99Ms, 990},
+	} {
+		if math.Abs(tt.got-tt.want) > 5 {
+			t.Errorf("Expected %s around %vms, got %vms", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestLatencyWindowSlides(t *testing.T) {
+	l := newLatencyWindow(10)
+	for i := 0; i < 10; i++ {
+		l.observe(time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		l.observe(time.Millisecond)
+	}
+
+	stats := l.stats()
+	if stats.Count != 10 || stats.Window != 10 {
+		t.Errorf("Expected 10 samples in a window of 10, got %d in %d", stats.Count, stats.Window)
+	}
+	if stats.P99Ms != 1 {
+		t.Errorf("Expected old samples to be evicted, got p99 %vms", stats.P99Ms)
+	}
+}
+
+func TestDebugStatsObservesUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer upstream.Close()
+
+	h := newHandler(&Config{OpenWebUIURL: upstream.URL, Debug: true})
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	h.forwardAndTransform(httptest.NewRecorder(), req.WithContext(logr.NewContext(context.Background(), logr.Discard())))
+
+	if n := h.latencies.stats().Count; n != 1 {
+		t.Errorf("Expected the upstream latency to be recorded, got %d samples", n)
+	}
+}
@@ -0,0 +1,508 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// maxStreamLineBytes bounds a single line read from an upstream stream.
+	maxStreamLineBytes = 1024 * 1024
+	// streamDoneMarker terminates an OpenAI compatible event stream.
+	streamDoneMarker = "[DONE]"
+)
+
+// OpenAI Compatible Streaming Chunk Structure
+type OpenAIChatChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+	// SystemFingerprint is the same for all chunks of a stream unless the upstream changes it.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	// Usage is only set on the final usage chunk, see StreamOptions.
+	Usage *TokenUsage `json:"usage,omitempty"`
+}
+
+// StreamOptions are the OpenAI stream_options of a chat request.
+type StreamOptions struct {
+	// IncludeUsage requests a final chunk carrying the usage of the stream.
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type ChunkDelta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// streamChatCompletion relays an upstream streaming chat response to the client
+// as OpenAI chat.completion.chunk server-sent events. If the upstream stream is
+// interrupted, a terminal error event is written so clients can detect the truncation.
+// ctx bounds the upstream request: once the client disconnects it is canceled,
+// which aborts the upstream read instead of draining the rest of the stream.
+// Upstreams that ignore the stream flag and answer with a single JSON document are
+// relayed by streamBufferedResponse instead. With includeUsage, the usage of the
+// stream is sent in a final chunk before the terminator. A stream running longer
+// than Config.MaxStreamDurationSec is cut off with a terminal error event. It
+// returns the usage of the part of the stream that was relayed.
+func (h *handler) streamChatCompletion(ctx context.Context, w http.ResponseWriter, log logr.Logger, resp *http.Response, model string, includeUsage bool) (relayed TokenUsage) {
+	defer h.metrics.trackStream()()
+	if isBufferedResponse(resp) {
+		return h.streamBufferedResponse(w, log, resp, model, includeUsage)
+	}
+	sw, ok := h.startEventStream(w, log)
+	if !ok {
+		return
+	}
+	defer sw.keepAlive(time.Duration(h.Config.StreamKeepAliveSec) * time.Second)()
+
+	chunk := newChatChunk(model)
+	chunk.SystemFingerprint = h.systemFingerprint("")
+	chunks := 0
+	var toolCalls toolCallIndexer
+	var usage streamUsage
+	defer func() { relayed = usage.total() }()
+
+	var capped atomic.Bool
+	if limit := time.Duration(h.Config.MaxStreamDurationSec) * time.Second; limit > 0 {
+		// Closing the body unblocks the scanner below.
+		timer := time.AfterFunc(limit, func() {
+			capped.Store(true)
+			resp.Body.Close()
+		})
+		defer timer.Stop()
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+	for scanner.Scan() {
+		payload, ok := parseStreamLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if payload == streamDoneMarker {
+			break
+		}
+
+		var part OpenWebUIChatResponse
+		if err := json.Unmarshal([]byte(payload), &part); err != nil {
+			log.Error(err, "Invalid upstream stream frame", "frame", payload)
+			continue
+		}
+		usage.observe(part)
+		if part.SystemFingerprint != "" {
+			chunk.SystemFingerprint = part.SystemFingerprint
+		}
+
+		delta := ChunkDelta{Content: part.Message.Content, ToolCalls: toolCalls.deltas(part.Message.ToolCalls)}
+		if chunks == 0 {
+			delta.Role = part.Message.Role
+			if delta.Role == "" || h.Config.NormalizeAssistantRole {
+				delta.Role = "assistant"
+			}
+		}
+		chunk.Choices = []ChunkChoice{{Index: 0, Delta: delta}}
+		if err := sw.event(chunk); err != nil {
+			// The client is gone; closing the body aborts the upstream request.
+			log.Error(err, "Failed to write stream chunk, aborting upstream stream", "chunks", chunks, "completion_tokens", usage.completionTokens)
+			resp.Body.Close()
+			return
+		}
+		chunks++
+	}
+
+	if capped.Load() {
+		log.Info("Stream exceeded the maximum duration, closing it", "max_stream_duration_sec", h.Config.MaxStreamDurationSec, "chunks", chunks, "completion_tokens", usage.completionTokens)
+		frame := OpenAIErrorResponse{Error: OpenAIError{
+			Message: fmt.Sprintf("stream exceeded the maximum duration of %ds", h.Config.MaxStreamDurationSec),
+			Type:    "server_error",
+			Code:    "max_stream_duration",
+		}}
+		if err := sw.event(frame); err != nil {
+			log.Error(err, "Failed to write stream error frame")
+		}
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			log.Info("Client disconnected, upstream stream aborted", "chunks", chunks, "completion_tokens", usage.completionTokens, "reason", context.Cause(ctx).Error())
+			return
+		}
+		log.Error(err, "Upstream stream interrupted", "chunks", chunks, "completion_tokens", usage.completionTokens)
+		frame := OpenAIErrorResponse{Error: OpenAIError{
+			Message: "upstream stream interrupted: " + err.Error(),
+			Type:    "upstream_error",
+		}}
+		if err := sw.event(frame); err != nil {
+			log.Error(err, "Failed to write stream error frame")
+		}
+		return
+	}
+
+	finish := "stop"
+	if toolCalls.count > 0 {
+		finish = "tool_calls"
+	}
+	chunk.Choices = []ChunkChoice{{Index: 0, Delta: ChunkDelta{}, FinishReason: &finish}}
+	if err := sw.event(chunk); err != nil {
+		log.Error(err, "Failed to write final stream chunk")
+		return
+	}
+	total := usage.total()
+	h.metrics.observeUsage(model, total)
+	if !finishStream(sw, log, chunk, total, includeUsage) {
+		return
+	}
+	h.accessLog(log).Info("Successfully streamed chat completion", "response_id", chunk.ID, "chunks", chunks, "completion_tokens", total.CompletionTokens)
+	return total
+}
+
+// finishStream writes the usage chunk when includeUsage is set and then the
+// stream terminator, reporting whether both were written.
+func finishStream(sw *sseWriter, log logr.Logger, chunk OpenAIChatChunk, usage TokenUsage, includeUsage bool) bool {
+	if includeUsage {
+		chunk.Choices = []ChunkChoice{}
+		chunk.Usage = &usage
+		if err := sw.event(chunk); err != nil {
+			log.Error(err, "Failed to write stream usage chunk")
+			return false
+		}
+	}
+	if err := sw.data(streamDoneMarker); err != nil {
+		log.Error(err, "Failed to write stream terminator")
+		return false
+	}
+	return true
+}
+
+// streamUsage accumulates the token usage of a stream as its frames arrive.
+// Every frame carrying content or tool calls counts as one completion token,
+// the granularity at which Open-WebUI and Ollama stream, unless the upstream
+// reports counts of its own, which then take precedence.
+type streamUsage struct {
+	// completionTokens is the running count of completion tokens so far.
+	completionTokens int
+	reported         *TokenUsage
+}
+
+func (u *streamUsage) observe(part OpenWebUIChatResponse) {
+	if part.Usage != nil || part.EvalCount > 0 {
+		reported := part.tokenUsage()
+		u.reported = &reported
+	}
+	if part.Message.Content != "" || len(part.Message.ToolCalls) > 0 {
+		u.completionTokens++
+	}
+}
+
+// total returns the usage of the stream so far.
+func (u *streamUsage) total() TokenUsage {
+	if u.reported != nil {
+		return *u.reported
+	}
+	return TokenUsage{CompletionTokens: u.completionTokens, TotalTokens: u.completionTokens}
+}
+
+// isBufferedResponse reports whether an upstream answered a streaming request
+// with a complete JSON document rather than an event or NDJSON stream.
+func isBufferedResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// streamBufferedResponse degrades gracefully for upstreams that do not support
+// streaming: the complete response is sent as a single chunk carrying the whole
+// message, followed by the finish chunk and the stream terminator. It returns the
+// usage of the response, or zero usage if no message was relayed.
+func (h *handler) streamBufferedResponse(w http.ResponseWriter, log logr.Logger, resp *http.Response, model string, includeUsage bool) TokenUsage {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err, "Failed to read WebUI response body")
+		http.Error(w, "Failed to read WebUI response", http.StatusBadGateway)
+		return TokenUsage{}
+	}
+	webuiResp, err := parseUpstreamChatResponse(body, h.Config.UpstreamResponseFormat)
+	if err != nil || webuiResp.Message.isEmpty() {
+		log.Error(fmt.Errorf("Open-WebUI response contains no message"), "Upstream error", "response_body", string(body))
+		http.Error(w, "Open-WebUI returned no usable message", http.StatusBadGateway)
+		return TokenUsage{}
+	}
+	log.Info("Upstream returned a buffered response to a streaming request, sending it as a single chunk")
+	usage := webuiResp.tokenUsage()
+	h.metrics.observeUsage(model, usage)
+
+	sw, ok := h.startEventStream(w, log)
+	if !ok {
+		return TokenUsage{}
+	}
+	message := webuiResp.Message
+	if message.Role == "" || h.Config.NormalizeAssistantRole {
+		message.Role = "assistant"
+	}
+	var toolCalls toolCallIndexer
+	chunk := newChatChunk(model)
+	chunk.SystemFingerprint = h.systemFingerprint(webuiResp.SystemFingerprint)
+	chunk.Choices = []ChunkChoice{{Index: 0, Delta: ChunkDelta{
+		Role:      message.Role,
+		Content:   message.Content,
+		ToolCalls: toolCalls.deltas(message.ToolCalls),
+	}}}
+	if err := sw.event(chunk); err != nil {
+		log.Error(err, "Failed to write stream chunk")
+		return usage
+	}
+	finish := message.finishReason()
+	chunk.Choices = []ChunkChoice{{Index: 0, Delta: ChunkDelta{}, FinishReason: &finish}}
+	if err := sw.event(chunk); err != nil {
+		log.Error(err, "Failed to write final stream chunk")
+		return usage
+	}
+	if !finishStream(sw, log, chunk, usage, includeUsage) {
+		return usage
+	}
+	h.accessLog(log).Info("Successfully streamed chat completion", "response_id", chunk.ID, "chunks", 1)
+	return usage
+}
+
+// startEventStream commits the event stream response headers. It writes an
+// error response and reports false if w cannot stream.
+func (h *handler) startEventStream(w http.ResponseWriter, log logr.Logger) (*sseWriter, bool) {
+	sw, ok := h.newSSEWriter(w)
+	if !ok {
+		log.Error(fmt.Errorf("response writer does not support flushing"), "Streaming unsupported")
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	sw.flush()
+	return sw, true
+}
+
+func newChatChunk(model string) OpenAIChatChunk {
+	return OpenAIChatChunk{
+		ID:      "chatcmpl-" + randomString(10),
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+}
+
+// streamFallbackHeader tells clients rejected by the streaming connection limit
+// that the same request is still accepted without streaming.
+const streamFallbackHeader = "X-Stream-Fallback"
+
+// acquireStream reserves one of Config.MaxStreamingConnections stream slots,
+// reporting false if all are in use. The returned release frees the slot.
+func (h *handler) acquireStream() (release func(), ok bool) {
+	limit := int64(h.Config.MaxStreamingConnections)
+	if limit <= 0 {
+		return func() {}, true
+	}
+	if h.streams.Add(1) > limit {
+		h.streams.Add(-1)
+		return nil, false
+	}
+	return func() { h.streams.Add(-1) }, true
+}
+
+// toolCallIndexer turns upstream tool calls into OpenAI delta.tool_calls entries.
+// OpenAI-style upstreams stream indexed fragments of each call, while Ollama sends
+// every call whole and unindexed; the latter are numbered in arrival order.
+type toolCallIndexer struct {
+	count int
+}
+
+func (t *toolCallIndexer) deltas(calls []ToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	deltas := make([]ToolCall, 0, len(calls))
+	for _, call := range calls {
+		index := t.count
+		if call.Index != nil {
+			index = *call.Index
+		}
+		if index >= t.count {
+			t.count = index + 1
+		}
+		call.Index = &index
+		if call.Function.Name != "" {
+			// The first fragment of a call carries its name, id and type.
+			if call.ID == "" {
+				call.ID = "call_" + randomString(8)
+			}
+			if call.Type == "" {
+				call.Type = "function"
+			}
+		}
+		deltas = append(deltas, call)
+	}
+	return deltas
+}
+
+// closeAfterStream marks the connection of an HTTP/1.0 client to be closed once
+// the stream ends. Without chunked encoding the end of the connection is the only
+// way for such clients to find the end of the stream, so keep-alive must not be
+// assumed even if the client asked for it.
+func closeAfterStream(w http.ResponseWriter, r *http.Request) {
+	if !r.ProtoAtLeast(1, 1) {
+		w.Header().Set("Connection", "close")
+	}
+}
+
+// acceptsEventStream reports whether the client asked for a server-sent event
+// stream via the Accept header. Streaming is enabled when either the request body
+// sets "stream": true or the Accept header lists text/event-stream; an omitted or
+// false stream field does not override the Accept header.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseStreamLine extracts the payload from an upstream stream line. Both
+// server-sent events ("data: {...}") and newline-delimited JSON are accepted.
+func parseStreamLine(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, ":") {
+		return "", false
+	}
+	if strings.HasPrefix(line, "data:") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	} else if strings.HasPrefix(line, "event:") || strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "retry:") {
+		return "", false
+	}
+	return line, line != ""
+}
+
+// sseWriter writes server-sent events to a client. The server's WriteTimeout
+// protects buffered responses against slow clients but would cut long streams
+// short, so the write deadline is pushed forward before every frame instead.
+// Frames are written under mu, so keepalive comments sent from another goroutine
+// never interleave with data frames.
+type sseWriter struct {
+	mu           sync.Mutex
+	w            http.ResponseWriter
+	flusher      http.Flusher
+	rc           *http.ResponseController
+	writeTimeout time.Duration
+}
+
+// newSSEWriter creates an sseWriter for w, reporting false if w cannot flush.
+func (h *handler) newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	return &sseWriter{
+		w:            w,
+		flusher:      flusher,
+		rc:           http.NewResponseController(w),
+		writeTimeout: time.Duration(h.Config.WriteTimeoutSec) * time.Second,
+	}, true
+}
+
+// extendDeadline gives the next frame a full write timeout. Writers that do not
+// support deadlines, such as test recorders, are left untouched.
+func (s *sseWriter) extendDeadline() {
+	if s.writeTimeout > 0 {
+		_ = s.rc.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	}
+}
+
+func (s *sseWriter) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extendDeadline()
+	s.flusher.Flush()
+}
+
+// event writes v as a single server-sent event and flushes it to the client.
+func (s *sseWriter) event(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.data(string(data))
+}
+
+// data writes a raw server-sent event data frame and flushes it to the client.
+func (s *sseWriter) data(data string) error {
+	return s.write("data: " + data + "\n\n")
+}
+
+// comment writes a server-sent event comment, which clients ignore.
+func (s *sseWriter) comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+// write writes a complete frame and flushes it to the client.
+func (s *sseWriter) write(frame string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extendDeadline()
+	if _, err := io.WriteString(s.w, frame); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// keepAlive writes a keepalive comment every interval until the returned stop
+// function is called, so that idle connections are not dropped by proxies while
+// the upstream is slow. stop waits for the writer goroutine to exit; a zero
+// interval disables keepalives.
+func (s *sseWriter) keepAlive(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.comment("keepalive"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
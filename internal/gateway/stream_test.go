@@ -0,0 +1,696 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// readEvents returns the data payloads of all server-sent events in body.
+func readEvents(t *testing.T, body io.Reader) []string {
+	t.Helper()
+	var events []string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	return events
+}
+
+func newStreamRequest(t *testing.T) *http.Request {
+	t.Helper()
+	chatReq := OpenAIChatRequest{
+		Model:    "test-model",
+		Messages: []MessageItem{{Role: "user", Content: "Hello"}},
+		Stream:   true,
+	}
+	body, _ := json.Marshal(chatReq)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+}
+
+func TestStreamChatCompletions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		if !upstreamReq.Stream {
+			t.Errorf("Expected stream flag to be forwarded upstream")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hel\"}}\n\n")
+		fmt.Fprint(w, "data: {\"message\":{\"content\":\"lo\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	events := readEvents(t, resp.Body)
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d: %v", len(events), events)
+	}
+	var content string
+	for _, e := range events[:3] {
+		var chunk OpenAIChatChunk
+		if err := json.Unmarshal([]byte(e), &chunk); err != nil {
+			t.Fatalf("Failed to decode chunk %q: %v", e, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("Expected object chat.completion.chunk, got %s", chunk.Object)
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Hello" {
+		t.Errorf("Expected streamed content 'Hello', got '%s'", content)
+	}
+	if events[3] != streamDoneMarker {
+		t.Errorf("Expected final event %s, got %s", streamDoneMarker, events[3])
+	}
+}
+
+func TestStreamChatCompletionsUsage(t *testing.T) {
+	tokens := []string{"He", "llo", ",", " wor", "ld"}
+	for _, reported := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, token := range tokens {
+				fmt.Fprintf(w, "data: {\"message\":{\"content\":%q}}\n\n", token)
+			}
+			if reported {
+				fmt.Fprint(w, "data: {\"message\":{\"content\":\"\"},\"prompt_eval_count\":7,\"eval_count\":6}\n\n")
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+		req := newStreamRequest(t)
+		body, _ := json.Marshal(OpenAIChatRequest{
+			Model:         "test-model",
+			Messages:      []MessageItem{{Role: "user", Content: "Hello"}},
+			Stream:        true,
+			StreamOptions: &StreamOptions{IncludeUsage: true},
+		})
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		ts.Close()
+
+		events := readEvents(t, w.Result().Body)
+		if len(events) < 2 || events[len(events)-1] != streamDoneMarker {
+			t.Fatalf("Expected the stream to end with %s, got %v", streamDoneMarker, events)
+		}
+		var usageChunk OpenAIChatChunk
+		if err := json.Unmarshal([]byte(events[len(events)-2]), &usageChunk); err != nil {
+			t.Fatalf("Failed to decode usage chunk: %v", err)
+		}
+		if usageChunk.Usage == nil || usageChunk.Choices == nil || len(usageChunk.Choices) != 0 {
+			t.Fatalf("Expected a usage chunk with empty choices, got %s", events[len(events)-2])
+		}
+		want := TokenUsage{CompletionTokens: len(tokens), TotalTokens: len(tokens)}
+		if reported {
+			want = TokenUsage{PromptTokens: 7, CompletionTokens: 6, TotalTokens: 13}
+		}
+		if *usageChunk.Usage != want {
+			t.Errorf("Expected streamed usage %+v with upstream counts=%v, got %+v", want, reported, *usageChunk.Usage)
+		}
+		for _, e := range events[:len(events)-2] {
+			if strings.Contains(e, `"usage"`) {
+				t.Errorf("Expected usage only on the final chunk, got %s", e)
+			}
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"message\":{\"content\":\"Hi\"}}\n\ndata: [DONE]\n\n")
+	}))
+	defer ts.Close()
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+	if strings.Contains(w.Body.String(), `"usage"`) {
+		t.Errorf("Expected no usage chunk unless requested, got %s", w.Body.String())
+	}
+}
+
+func TestStreamChatCompletionsUpstreamDrop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		frame := "data: {\"message\":{\"role\":\"assistant\",\"content\":\"partial\"}}\n\n"
+		fmt.Fprint(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nTransfer-Encoding: chunked\r\n\r\n")
+		fmt.Fprintf(buf, "%x\r\n%s\r\n", len(frame), frame)
+		buf.Flush()
+		// Close without sending the terminating chunk.
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+
+	events := readEvents(t, w.Result().Body)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %v", len(events), events)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal([]byte(events[1]), &errResp); err != nil {
+		t.Fatalf("Failed to decode error frame %q: %v", events[1], err)
+	}
+	if errResp.Error.Message == "" || errResp.Error.Type != "upstream_error" {
+		t.Errorf("Expected upstream_error frame, got %+v", errResp.Error)
+	}
+	for _, e := range events {
+		if e == streamDoneMarker {
+			t.Errorf("Did not expect %s after an interrupted stream", streamDoneMarker)
+		}
+	}
+}
+
+func TestStreamChatCompletionsMaxDuration(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for {
+			fmt.Fprint(w, "data: {\"message\":{\"content\":\"more\"}}\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxStreamDurationSec: 1}}
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.handleChatCompletions(w, newStreamRequest(t))
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("Expected the stream to be closed at the 1s cap, took %v", elapsed)
+	}
+
+	events := readEvents(t, w.Result().Body)
+	if len(events) < 2 {
+		t.Fatalf("Expected content events before the cap, got %v", events)
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal([]byte(events[len(events)-1]), &errResp); err != nil {
+		t.Fatalf("Failed to decode terminal frame %q: %v", events[len(events)-1], err)
+	}
+	if errResp.Error.Code != "max_stream_duration" {
+		t.Errorf("Expected a max_stream_duration terminal frame, got %+v", errResp.Error)
+	}
+}
+
+func TestStreamChatCompletionsAcceptHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		if !upstreamReq.Stream {
+			t.Errorf("Expected Accept header to enable upstream streaming")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hi\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json;q=0.9, text/event-stream")
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+
+	h.handleChatCompletions(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+	events := readEvents(t, w.Result().Body)
+	if len(events) == 0 || events[len(events)-1] != streamDoneMarker {
+		t.Errorf("Expected a terminated event stream, got %v", events)
+	}
+}
+
+func TestAcceptsEventStream(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"text/event-stream", true},
+		{"application/json, text/event-stream;q=0.5", true},
+		{"*/*", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := acceptsEventStream(req); got != tt.want {
+			t.Errorf("acceptsEventStream(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestStreamingWriteTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		if !upstreamReq.Stream {
+			// Slow buffered response that outlives the write timeout.
+			time.Sleep(1500 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "late"}})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 6; i++ {
+			fmt.Fprint(w, "data: {\"message\":{\"content\":\"tick\"}}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{OpenWebUIURL: upstream.URL, WriteTimeoutSec: 1}
+	h := &handler{Config: cfg}
+	ts := httptest.NewUnstartedServer(wrapLogger(logr.Discard(), h.handleChatCompletions))
+	ts.Config.WriteTimeout = time.Duration(cfg.WriteTimeoutSec) * time.Second
+	ts.Start()
+	defer ts.Close()
+
+	t.Run("long stream is not cut off", func(t *testing.T) {
+		body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "stream": true}`
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		events := readEvents(t, resp.Body)
+		if len(events) == 0 || events[len(events)-1] != streamDoneMarker {
+			t.Errorf("Expected the stream to complete past the write timeout, got %v", events)
+		}
+	})
+
+	t.Run("slow buffered response is cut off", func(t *testing.T) {
+		body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		if err == nil {
+			defer resp.Body.Close()
+			if _, err = io.ReadAll(resp.Body); err == nil {
+				t.Errorf("Expected the buffered response to be cut off by the write timeout, got status %d", resp.StatusCode)
+			}
+		}
+	})
+}
+
+func TestStreamChatCompletionsToolCalls(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// An indexed call streamed in fragments, followed by a whole Ollama-style call.
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"tool_calls\":[{\"index\":0,\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}\n\n")
+		fmt.Fprint(w, "data: {\"message\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\"}}]}}\n\n")
+		fmt.Fprint(w, "data: {\"message\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Tokyo\\\"}\"}}]}}\n\n")
+		fmt.Fprint(w, "data: {\"message\":{\"tool_calls\":[{\"function\":{\"name\":\"get_time\",\"arguments\":{\"zone\": \"JST\"}}}]}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+
+	events := readEvents(t, w.Result().Body)
+	if len(events) != 6 {
+		t.Fatalf("Expected 6 events, got %d: %v", len(events), events)
+	}
+	var deltas []ToolCall
+	var finish *string
+	for _, e := range events[:5] {
+		var chunk OpenAIChatChunk
+		if err := json.Unmarshal([]byte(e), &chunk); err != nil {
+			t.Fatalf("Failed to decode chunk %q: %v", e, err)
+		}
+		deltas = append(deltas, chunk.Choices[0].Delta.ToolCalls...)
+		finish = chunk.Choices[0].FinishReason
+	}
+	if len(deltas) != 4 {
+		t.Fatalf("Expected 4 tool call deltas, got %d", len(deltas))
+	}
+
+	first := deltas[0]
+	if first.Index == nil || *first.Index != 0 || first.ID == "" || first.Type != "function" || first.Function.Name != "get_weather" {
+		t.Errorf("Expected the first delta to open call 0 with id, type and name, got %+v", first)
+	}
+	var args string
+	for _, d := range deltas[1:3] {
+		if d.Index == nil || *d.Index != 0 || d.ID != "" || d.Function.Name != "" {
+			t.Errorf("Expected an argument fragment of call 0, got %+v", d)
+		}
+		args += d.Function.Arguments
+	}
+	if args != `{"city":"Tokyo"}` {
+		t.Errorf("Expected concatenated arguments {\"city\":\"Tokyo\"}, got %s", args)
+	}
+
+	last := deltas[3]
+	if last.Index == nil || *last.Index != 1 || last.ID == "" || last.Function.Name != "get_time" || last.Function.Arguments != `{"zone":"JST"}` {
+		t.Errorf("Expected a whole call 1 with encoded arguments, got %+v", last)
+	}
+	if finish == nil || *finish != "tool_calls" {
+		t.Errorf("Expected finish_reason tool_calls, got %v", finish)
+	}
+	if !strings.Contains(events[1], `"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]`) {
+		t.Errorf("Expected an OpenAI shaped argument delta frame, got %s", events[1])
+	}
+}
+
+func TestStreamChatCompletionsHTTP10(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hi\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL}}
+	ts := httptest.NewServer(wrapLogger(logr.Discard(), h.handleChatCompletions))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "stream": true}`
+	// Ask for keep-alive: the stream must still end by closing the connection.
+	fmt.Fprintf(conn, "POST /v1/chat/completions HTTP/1.0\r\nHost: gateway\r\nConnection: keep-alive\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "POST"})
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.ProtoMajor != 1 || resp.ProtoMinor != 0 {
+		t.Errorf("Expected an HTTP/1.0 response, got %s", resp.Proto)
+	}
+	if len(resp.TransferEncoding) != 0 {
+		t.Errorf("Expected no transfer encoding for HTTP/1.0, got %v", resp.TransferEncoding)
+	}
+	if !resp.Close {
+		t.Errorf("Expected Connection: close for an HTTP/1.0 stream, got %q", resp.Header.Get("Connection"))
+	}
+	// readEvents only returns once the server closes the connection.
+	events := readEvents(t, resp.Body)
+	if len(events) == 0 || events[len(events)-1] != streamDoneMarker {
+		t.Errorf("Expected a complete event stream, got %v", events)
+	}
+}
+
+func TestStreamChatCompletionsClientDisconnect(t *testing.T) {
+	aborted := make(chan int, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for sent := 0; ; sent++ {
+			select {
+			case <-r.Context().Done():
+				aborted <- sent
+				return
+			case <-ticker.C:
+			}
+			fmt.Fprint(w, "data: {\"message\":{\"content\":\"tick\"}}\n\n")
+			w.(http.Flusher).Flush()
+			if sent > 500 {
+				// The gateway kept draining the stream after the client left.
+				aborted <- -1
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL}}
+	ts := httptest.NewServer(wrapLogger(logr.Discard(), h.handleChatCompletions))
+	defer ts.Close()
+
+	body := `{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}], "stream": true}`
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("Expected a first stream event, got %q (%v)", line, err)
+	}
+	// Disconnect mid-stream.
+	resp.Body.Close()
+
+	select {
+	case sent := <-aborted:
+		if sent < 0 {
+			t.Errorf("Expected the upstream stream to be aborted after the client disconnected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the upstream stream to be aborted")
+	}
+}
+
+func TestStreamChatCompletionsBufferedFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An upstream that ignores the stream flag and answers with pretty-printed JSON.
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte("{\n  \"message\": {\n    \"role\": \"assistant\",\n    \"content\": \"Hello there\"\n  }\n}\n"))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	events := readEvents(t, resp.Body)
+	if len(events) != 3 {
+		t.Fatalf("Expected a single chunk, a finish chunk and the terminator, got %d: %v", len(events), events)
+	}
+	var chunk OpenAIChatChunk
+	if err := json.Unmarshal([]byte(events[0]), &chunk); err != nil {
+		t.Fatalf("Failed to decode chunk: %v", err)
+	}
+	if chunk.Object != "chat.completion.chunk" || len(chunk.Choices) != 1 {
+		t.Fatalf("Unexpected chunk: %+v", chunk)
+	}
+	if delta := chunk.Choices[0].Delta; delta.Role != "assistant" || delta.Content != "Hello there" {
+		t.Errorf("Expected the whole message in a single chunk, got %+v", delta)
+	}
+	var final OpenAIChatChunk
+	if err := json.Unmarshal([]byte(events[1]), &final); err != nil {
+		t.Fatalf("Failed to decode final chunk: %v", err)
+	}
+	if final.ID != chunk.ID || final.Choices[0].FinishReason == nil || *final.Choices[0].FinishReason != "stop" {
+		t.Errorf("Expected a stop finish chunk for the same completion, got %+v", final)
+	}
+	if events[2] != streamDoneMarker {
+		t.Errorf("Expected stream terminator, got %s", events[2])
+	}
+}
+
+func TestStreamChatCompletionsBufferedFallbackNoMessage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+}
+
+// checkFrames asserts that body consists of whole data frames carrying JSON and
+// keepalive comments only, and returns the number of each.
+func checkFrames(t *testing.T, body string) (data, comments int) {
+	t.Helper()
+	for _, frame := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		switch {
+		case frame == ": keepalive":
+			comments++
+		case strings.HasPrefix(frame, "data: ") && json.Valid([]byte(strings.TrimPrefix(frame, "data: "))):
+			data++
+		default:
+			t.Fatalf("Corrupted stream frame %q", frame)
+		}
+	}
+	return data, comments
+}
+
+func TestSSEWriterConcurrentWrites(t *testing.T) {
+	h := &handler{Config: &Config{}}
+	w := httptest.NewRecorder()
+	sw, ok := h.newSSEWriter(w)
+	if !ok {
+		t.Fatal("Expected the recorder to support flushing")
+	}
+
+	const writes = 200
+	stop := sw.keepAlive(time.Microsecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < writes; i++ {
+			if err := sw.comment("keepalive"); err != nil {
+				t.Errorf("Failed to write comment: %v", err)
+			}
+		}
+	}()
+	chunk := newChatChunk("test-model")
+	chunk.Choices = []ChunkChoice{{Delta: ChunkDelta{Content: strings.Repeat("x", 512)}}}
+	for i := 0; i < writes; i++ {
+		if err := sw.event(chunk); err != nil {
+			t.Fatalf("Failed to write event: %v", err)
+		}
+	}
+	<-done
+	stop()
+
+	data, comments := checkFrames(t, w.Body.String())
+	if data != writes || comments < writes {
+		t.Errorf("Expected %d data frames and at least %d comments, got %d and %d", writes, writes, data, comments)
+	}
+}
+
+func TestSSEWriterKeepAliveStops(t *testing.T) {
+	h := &handler{Config: &Config{}}
+	w := httptest.NewRecorder()
+	sw, _ := h.newSSEWriter(w)
+
+	stop := sw.keepAlive(5 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	written := w.Body.Len()
+	time.Sleep(20 * time.Millisecond)
+
+	if _, comments := checkFrames(t, w.Body.String()); comments == 0 {
+		t.Errorf("Expected keepalive comments while the stream is idle")
+	}
+	if w.Body.Len() != written {
+		t.Errorf("Expected no keepalive comments after stop")
+	}
+}
+
+func TestMaxStreamingConnections(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upstreamReq OpenAIChatRequest
+		json.NewDecoder(r.Body).Decode(&upstreamReq)
+		if !upstreamReq.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"message\":{\"role\":\"assistant\",\"content\":\"Hel\"}}\n\n")
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-release
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL, MaxStreamingConnections: 1}}
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, newStreamRequest(t))
+		first <- w
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, newStreamRequest(t))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d once the streaming limit is reached, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("X-Stream-Fallback"); got != "buffered" {
+		t.Errorf("Expected the buffered fallback to be offered, got %q", got)
+	}
+
+	// Buffered requests are not limited.
+	body, _ := json.Marshal(OpenAIChatRequest{Model: "test-model", Messages: []MessageItem{{Role: "user", Content: "Hello"}}})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	h.handleChatCompletions(w, req.WithContext(logr.NewContext(context.Background(), logr.Discard())))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a buffered request to pass the streaming limit, got %d", w.Code)
+	}
+
+	close(release)
+	if w := <-first; w.Code != http.StatusOK {
+		t.Errorf("Expected the first stream to complete, got %d", w.Code)
+	}
+
+	// The slot is freed once the stream ends.
+	w = httptest.NewRecorder()
+	go func() { <-started }()
+	h.handleChatCompletions(w, newStreamRequest(t))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a new stream after the first ended, got %d", w.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+)
+
+// chatPath is the Open-WebUI path chat completions are sent to by default.
+const chatPath = "/chat"
+
+// chatTargetPath returns the Open-WebUI path for a chat completion with model.
+// Models listed in Config.TaskRoutes are sent to their task endpoint, such as
+// title or tag generation, instead of chatPath.
+func (h *handler) chatTargetPath(model string) string {
+	if path, ok := h.Config.TaskRoutes[model]; ok {
+		return path
+	}
+	return chatPath
+}
+
+// parseTaskRoutes parses "model=path" flag values into a task route map.
+func parseTaskRoutes(values []string) (map[string]string, error) {
+	routes := make(map[string]string, len(values))
+	for _, v := range values {
+		model, path, ok := strings.Cut(v, "=")
+		model = strings.TrimSpace(model)
+		path = strings.TrimSpace(path)
+		if !ok || model == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid task route %q, expected \"model=path\", e.g. title-generator=/v1/tasks/title/completions", v)
+		}
+		routes[model] = path
+	}
+	return routes, nil
+}
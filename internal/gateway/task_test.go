@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestHandleChatCompletionsTaskRoutes(t *testing.T) {
+	var paths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "A title"}})
+	}))
+	defer upstream.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, TaskRoutes: map[string]string{"title-generator": "/v1/tasks/title/completions"}}}
+	for _, model := range []string{"title-generator", "test-model"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "`+model+`", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.handleChatCompletions(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusOK, model, w.Code)
+		}
+	}
+	if len(paths) != 2 || paths[0] != "/v1/tasks/title/completions" || paths[1] != "/chat" {
+		t.Errorf("Expected the task model to hit the task endpoint and others /chat, got %v", paths)
+	}
+}
+
+func TestParseTaskRoutes(t *testing.T) {
+	routes, err := parseTaskRoutes([]string{"title-generator=/v1/tasks/title/completions", " tagger = /v1/tasks/tags/completions "})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if routes["title-generator"] != "/v1/tasks/title/completions" || routes["tagger"] != "/v1/tasks/tags/completions" {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+	for _, v := range []string{"title-generator", "=/v1/tasks", "tagger=v1/tasks"} {
+		if _, err := parseTaskRoutes([]string{v}); err == nil {
+			t.Errorf("Expected an error for %q", v)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// transformStderrLimit bounds the stderr output of a request transform kept for errors.
+const transformStderrLimit = 1024
+
+// transformRequest pipes a chat request body through Config.RequestTransformCmd,
+// run with /bin/sh, and returns its standard output. The command is bounded by
+// Config.RequestTransformTimeoutSec, and a non-zero exit fails the request.
+func (h *handler) transformRequest(ctx context.Context, body []byte) ([]byte, error) {
+	timeout := time.Duration(h.Config.RequestTransformTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(defaultRequestTransformTimeoutSec) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.Config.RequestTransformCmd)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Do not wait for children that keep the output pipes open after a timeout.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("request transform timed out after %v", timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > transformStderrLimit {
+			msg = msg[:transformStderrLimit]
+		}
+		return nil, fmt.Errorf("request transform failed: %w: %s", err, msg)
+	}
+	return stdout.Bytes(), nil
+}
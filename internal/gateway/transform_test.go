@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestRequestTransformCmd(t *testing.T) {
+	payload := captureUpstreamPayload(t, &Config{RequestTransformCmd: "sed 's/Hello/Bonjour/'"},
+		`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`)
+
+	messages, _ := payload["messages"].([]any)
+	if len(messages) != 1 || messages[0].(map[string]any)["content"] != "Bonjour" {
+		t.Errorf("Expected the transformed body to be forwarded, got %v", payload["messages"])
+	}
+}
+
+func TestRequestTransformCmdFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		timeout int
+	}{
+		{"non-zero exit", "echo 'bad request' >&2; exit 3", 0},
+		{"timeout", "sleep 5", 1},
+	}
+	for _, tt := range tests {
+		h := &handler{Config: &Config{OpenWebUIURL: "http://dummy-url", RequestTransformCmd: tt.cmd, RequestTransformTimeoutSec: tt.timeout}}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		h.handleChatCompletions(w, req)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusInternalServerError, w.Code)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: Expected the transform to be bounded, took %v", tt.name, elapsed)
+		}
+	}
+}
+
+func TestTransformRequestError(t *testing.T) {
+	h := &handler{Config: &Config{RequestTransformCmd: "echo 'bad request' >&2; exit 3"}}
+	_, err := h.transformRequest(context.Background(), []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "bad request") {
+		t.Errorf("Expected the transform error to include stderr, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// newUpstreamClient builds the HTTP client shared by all requests to Open-WebUI.
+func newUpstreamClient(cfg *Config) *http.Client {
+	keepAlive := cfg.UpstreamKeepAliveSec
+	if keepAlive == 0 {
+		keepAlive = defaultUpstreamKeepAliveSec
+	}
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.DialTimeoutSec) * time.Second,
+		KeepAlive: time.Duration(keepAlive) * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Some upstreams misbehave on persistent connections.
+	transport.DisableKeepAlives = cfg.UpstreamDisableKeepAlive
+	if cfg.UpstreamMaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.UpstreamMaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, cfg.UpstreamMaxIdleConnsPerHost)
+	}
+	if cfg.UpstreamIdleConnTimeoutSec > 0 {
+		transport.IdleConnTimeout = time.Duration(cfg.UpstreamIdleConnTimeoutSec) * time.Second
+	}
+	if cfg.UpstreamProxy != "" {
+		// An explicit proxy takes precedence over the proxy environment variables.
+		if proxyURL, err := url.Parse(cfg.UpstreamProxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect(cfg.FollowRedirects)}
+}
+
+// maxRedirects bounds the number of upstream redirects followed for one request.
+const maxRedirects = 10
+
+// checkRedirect returns the redirect policy of the upstream client. Following
+// redirects blindly could reach hosts other than Open-WebUI (SSRF) or drop the
+// Authorization header, so redirects are not followed unless follow is set, and
+// even then only to the host of the original request. A redirect that is not
+// followed is handed back as the upstream response.
+func checkRedirect(follow bool) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !follow || req.URL.Host != via[0].URL.Host {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if auth := via[0].Header.Get("Authorization"); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return nil
+	}
+}
+
+// validateOpenWebUIURL reports an error unless raw is an absolute http or https
+// URL with a host. Values such as "localhost:8080" that lack a scheme are a
+// common misconfiguration and would otherwise only fail on the first request.
+func validateOpenWebUIURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid --open-webui-url: %w", err)
+	}
+	if !strings.Contains(raw, "://") {
+		return fmt.Errorf("invalid --open-webui-url %q: missing scheme, e.g. http://%s", raw, raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid --open-webui-url %q: scheme must be http or https", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid --open-webui-url %q: missing host", u.Redacted())
+	}
+	return nil
+}
+
+// validateUpstreamProxy reports an error if proxy is set but not an absolute
+// http, https or socks5 URL.
+func validateUpstreamProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid upstream proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid upstream proxy %q: scheme must be http, https or socks5", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid upstream proxy %q: missing host", u.Redacted())
+	}
+	return nil
+}
+
+// orgHeaders are the OpenAI account scoping headers, which Open-WebUI does not use.
+var orgHeaders = []string{"OpenAI-Organization", "OpenAI-Project"}
+
+// setOrgHeaders copies the orgHeaders of the client request r onto the upstream
+// request req when Config.ForwardOrgHeaders is set and strips them otherwise,
+// so chat completions and forwarded endpoints behave the same.
+func (h *handler) setOrgHeaders(req *http.Request, r *http.Request) {
+	for _, name := range orgHeaders {
+		req.Header.Del(name)
+		if !h.Config.ForwardOrgHeaders {
+			continue
+		}
+		for _, v := range r.Header.Values(name) {
+			req.Header.Add(name, v)
+		}
+	}
+}
+
+// upstreamClient returns the shared upstream client, creating it on first use.
+func (h *handler) upstreamClient() *http.Client {
+	h.clientOnce.Do(func() {
+		h.client = newUpstreamClient(h.Config)
+	})
+	return h.client
+}
+
+// setUpstreamAuth sets the Authorization header of an upstream request, using the
+// client's credentials when present and the configured API key otherwise. With
+// neither available a verbose warning is logged, as Open-WebUI will likely answer 401.
+func (h *handler) setUpstreamAuth(req *http.Request, r *http.Request) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+		return
+	}
+	if h.Config.OpenWebUIAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Config.OpenWebUIAPIKey)
+		return
+	}
+	logger.FromContext(req.Context()).V(1).Info("Warning: no Authorization header and no Open-WebUI API key configured, upstream request will likely be unauthenticated", "url", req.URL.String())
+}
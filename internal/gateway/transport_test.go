@@ -0,0 +1,325 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestUpstreamClientDialTimeout(t *testing.T) {
+	h := &handler{Config: &Config{DialTimeoutSec: 1}}
+
+	// 10.255.255.1 is a non-routable address, so the connection attempt
+	// hangs until the dial timeout fires (or fails immediately without a route).
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "http://10.255.255.1:81/health", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	start := time.Now()
+	resp, err := h.upstreamClient().Do(req)
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected connection to an unroutable address to fail")
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("Expected dial to fail within the configured timeout, took %v", elapsed)
+	}
+}
+
+func TestUpstreamClientShared(t *testing.T) {
+	h := &handler{Config: &Config{DialTimeoutSec: 1}}
+	if h.upstreamClient() != h.upstreamClient() {
+		t.Errorf("Expected the upstream client to be shared across calls")
+	}
+}
+
+func TestSetUpstreamAuthWarnsWhenUnauthenticated(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientAuth string
+		apiKey     string
+		wantWarn   bool
+	}{
+		{"no credentials", "", "", true},
+		{"client authorization", "Bearer client", "", false},
+		{"configured api key", "", "secret", false},
+	}
+	for _, tt := range tests {
+		var logs []string
+		log := funcr.New(func(prefix, args string) {
+			logs = append(logs, args)
+		}, funcr.Options{Verbosity: 1})
+
+		h := &handler{Config: &Config{OpenWebUIAPIKey: tt.apiKey}}
+		r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if tt.clientAuth != "" {
+			r.Header.Set("Authorization", tt.clientAuth)
+		}
+		req, err := http.NewRequestWithContext(logr.NewContext(context.Background(), log), "POST", "http://upstream/chat", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		h.setUpstreamAuth(req, r)
+
+		warned := false
+		for _, line := range logs {
+			if strings.Contains(line, "unauthenticated") {
+				warned = true
+			}
+		}
+		if warned != tt.wantWarn {
+			t.Errorf("%s: Expected warning %v, got %v (logs: %v)", tt.name, tt.wantWarn, warned, logs)
+		}
+	}
+}
+
+func TestUpstreamClientProxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests through a forward proxy carry the absolute target URL.
+		proxiedHost = r.URL.Host
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	// The explicit proxy must win over the proxy environment.
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	h := &handler{Config: &Config{DialTimeoutSec: 1, UpstreamProxy: proxy.URL}}
+	resp, err := h.upstreamClient().Get("http://open-webui.invalid/models")
+	if err != nil {
+		t.Fatalf("Expected the request to go through the proxy, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	if proxiedHost != "open-webui.invalid" {
+		t.Errorf("Expected the proxy to receive the upstream request, got host %q", proxiedHost)
+	}
+}
+
+func TestValidateUpstreamProxy(t *testing.T) {
+	tests := map[string]bool{
+		"":                            true,
+		"http://proxy:3128":           true,
+		"socks5://user:pw@proxy:1080": true,
+		"ftp://proxy":                 false,
+		"proxy:3128":                  false,
+		"http://":                     false,
+	}
+	for proxy, valid := range tests {
+		if err := validateUpstreamProxy(proxy); (err == nil) != valid {
+			t.Errorf("validateUpstreamProxy(%q) = %v, want valid %v", proxy, err, valid)
+		}
+	}
+}
+
+func TestUpstreamClientRedirects(t *testing.T) {
+	var externalHits int32
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&externalHits, 1)
+	}))
+	defer external.Close()
+
+	var upstreamAuth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			http.Redirect(w, r, "/moved/models", http.StatusFound)
+		case "/moved/models":
+			upstreamAuth = r.Header.Get("Authorization")
+			w.Write([]byte(`{"data": []}`))
+		case "/external":
+			http.Redirect(w, r, external.URL+"/steal", http.StatusFound)
+		}
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name       string
+		follow     bool
+		path       string
+		wantStatus int
+		wantAuth   string
+	}{
+		{"same host not followed by default", false, "/v1/models", http.StatusFound, ""},
+		{"same host followed with auth", true, "/v1/models", http.StatusOK, "Bearer client"},
+		{"external host not followed by default", false, "/v1/external", http.StatusFound, ""},
+		{"external host never followed", true, "/v1/external", http.StatusFound, ""},
+	}
+	for _, tt := range tests {
+		upstreamAuth = ""
+		h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, FollowRedirects: tt.follow}}
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Authorization", "Bearer client")
+		req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+		w := httptest.NewRecorder()
+		h.forwardAndTransform(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, tt.wantStatus, w.Code)
+		}
+		if upstreamAuth != tt.wantAuth {
+			t.Errorf("%s: Expected Authorization %q after the redirect, got %q", tt.name, tt.wantAuth, upstreamAuth)
+		}
+	}
+	if n := atomic.LoadInt32(&externalHits); n != 0 {
+		t.Errorf("Expected no request to reach the external host, got %d", n)
+	}
+}
+
+func TestUpstreamClientKeepAlive(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		var conns int32
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		}))
+		ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&conns, 1)
+			}
+		}
+		ts.Start()
+
+		h := &handler{Config: &Config{DialTimeoutSec: 1, UpstreamDisableKeepAlive: disable}}
+		for i := 0; i < 3; i++ {
+			resp, err := h.upstreamClient().Get(ts.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		ts.Close()
+
+		want := int32(1)
+		if disable {
+			want = 3
+		}
+		if n := atomic.LoadInt32(&conns); n != want {
+			t.Errorf("Expected %d upstream connections for 3 requests with keep-alive disabled=%v, got %d", want, disable, n)
+		}
+	}
+}
+
+func TestUpstreamClientIdleConnTimeout(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	h := &handler{Config: &Config{DialTimeoutSec: 1, UpstreamMaxIdleConnsPerHost: 4, UpstreamIdleConnTimeoutSec: 1}}
+	transport := h.upstreamClient().Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Second {
+		t.Errorf("Expected 4 idle connections per host with a 1s timeout, got %d and %v", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	resp, err := h.upstreamClient().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the idle upstream connection to be closed after the idle timeout")
+	}
+}
+
+func TestValidateOpenWebUIURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"http://localhost:8080/api", ""},
+		{"https://open-webui.example.com/api", ""},
+		{"localhost:8080", "missing scheme"},
+		{"open-webui/api", "missing scheme"},
+		{"ftp://open-webui.example.com", "scheme must be http or https"},
+		{"http:///api", "missing host"},
+		{"http://[::1", "invalid --open-webui-url"},
+	}
+	for _, tt := range tests {
+		err := validateOpenWebUIURL(tt.url)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateOpenWebUIURL(%q) returned unexpected error %v", tt.url, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateOpenWebUIURL(%q) = %v, want error containing %q", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProcessServeRejectsInvalidOpenWebUIURL(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	if err := processServe(ctx, &Config{OpenWebUIURL: "localhost:8080"}); err == nil {
+		t.Errorf("Expected startup to fail for an Open-WebUI URL without a scheme")
+	}
+}
+
+func TestForwardOrgHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat" {
+			w.Write([]byte(`{"message": {"role": "assistant", "content": "Hi"}}`))
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer ts.Close()
+
+	for _, forward := range []bool{false, true} {
+		h := &handler{Config: &Config{OpenWebUIURL: ts.URL, ForwardOrgHeaders: forward}}
+		tests := []struct {
+			name   string
+			handle http.HandlerFunc
+			req    *http.Request
+		}{
+			{"chat completion", h.handleChatCompletions, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))},
+			{"forward", h.forwardAndTransform, httptest.NewRequest("GET", "/v1/models", nil)},
+		}
+		for _, tt := range tests {
+			got = nil
+			tt.req.Header.Set("OpenAI-Organization", "org-123")
+			tt.req.Header.Set("OpenAI-Project", "proj-456")
+			w := httptest.NewRecorder()
+			tt.handle(w, tt.req.WithContext(logr.NewContext(context.Background(), logr.Discard())))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: Expected status code %d, got %d", tt.name, http.StatusOK, w.Code)
+			}
+			wantOrg, wantProject := "", ""
+			if forward {
+				wantOrg, wantProject = "org-123", "proj-456"
+			}
+			if org, project := got.Get("OpenAI-Organization"), got.Get("OpenAI-Project"); org != wantOrg || project != wantProject {
+				t.Errorf("%s with forwarding %v: Expected org headers %q/%q, got %q/%q", tt.name, forward, wantOrg, wantProject, org, project)
+			}
+		}
+	}
+}
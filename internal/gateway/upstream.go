@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// Supported upstream chat response formats.
+const (
+	// upstreamFormatAuto detects the format from the response shape.
+	upstreamFormatAuto = "auto"
+	// upstreamFormatOpenWebUI expects {"message": {...}} responses.
+	upstreamFormatOpenWebUI = "openwebui"
+	// upstreamFormatOllama expects {"message": {...}, "prompt_eval_count": n, "eval_count": n}.
+	upstreamFormatOllama = "ollama"
+	// upstreamFormatOpenAI expects {"choices": [{"message": {...}}], "usage": {...}}.
+	upstreamFormatOpenAI = "openai"
+)
+
+// openAIUpstreamResponse is the subset of an OpenAI-shaped upstream response
+// used by the gateway.
+type openAIUpstreamResponse struct {
+	Choices           []Choice    `json:"choices"`
+	Usage             *TokenUsage `json:"usage,omitempty"`
+	SystemFingerprint string      `json:"system_fingerprint,omitempty"`
+}
+
+// validateUpstreamFormat reports an error for unknown upstream response formats.
+func validateUpstreamFormat(format string) error {
+	switch format {
+	case "", upstreamFormatAuto, upstreamFormatOpenWebUI, upstreamFormatOllama, upstreamFormatOpenAI:
+		return nil
+	}
+	return fmt.Errorf("unsupported upstream response format %q", format)
+}
+
+// parseUpstreamChatResponse normalizes an upstream chat response in the given
+// format into an OpenWebUIChatResponse. Open-WebUI and Ollama share the same
+// top-level message shape; OpenAI nests the message under choices[0].
+func parseUpstreamChatResponse(body []byte, format string) (OpenWebUIChatResponse, error) {
+	var resp OpenWebUIChatResponse
+	switch format {
+	case upstreamFormatOpenWebUI, upstreamFormatOllama:
+		err := json.Unmarshal(body, &resp)
+		return resp, err
+	case upstreamFormatOpenAI:
+		return parseOpenAIUpstreamResponse(body)
+	}
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return resp, err
+	}
+	if !resp.Message.isEmpty() {
+		return resp, nil
+	}
+	if openai, err := parseOpenAIUpstreamResponse(body); err == nil && !openai.Message.isEmpty() {
+		return openai, nil
+	}
+	return resp, nil
+}
+
+func parseOpenAIUpstreamResponse(body []byte) (OpenWebUIChatResponse, error) {
+	var openai openAIUpstreamResponse
+	if err := json.Unmarshal(body, &openai); err != nil {
+		return OpenWebUIChatResponse{}, err
+	}
+	resp := OpenWebUIChatResponse{Usage: openai.Usage, SystemFingerprint: openai.SystemFingerprint}
+	if len(openai.Choices) > 0 {
+		resp.Message = openai.Choices[0].Message
+		resp.Logprobs = openai.Choices[0].Logprobs
+	}
+	return resp, nil
+}
+
+// chatUpstreamError is a failed upstream chat completion together with the
+// status and message reported to the client. When code is set, the message is
+// sent as an OpenAI-style error.
+type chatUpstreamError struct {
+	status  int
+	code    string
+	message string
+	err     error
+}
+
+func (e *chatUpstreamError) Error() string { return e.err.Error() }
+
+func (e *chatUpstreamError) Unwrap() error { return e.err }
+
+// sendChatRequest sends a chat completion to Open-WebUI and returns the
+// response if it succeeded. Non-OK responses are consumed and reported as a
+// *chatUpstreamError.
+func (h *handler) sendChatRequest(ctx context.Context, newReq upstreamRequestFunc) (*http.Response, error) {
+	log := logger.FromContext(ctx)
+	startTime := time.Now()
+	resp, err := h.doUpstream(withChatCompletion(ctx), newReq)
+	duration := time.Since(startTime)
+	if err != nil {
+		log.Error(err, "Failed to contact Open-WebUI", "duration_ms", duration.Milliseconds())
+		return nil, err
+	}
+	h.accessLog(log).Info("Received response from Open-WebUI", "status_code", resp.StatusCode, "duration_ms", duration.Milliseconds())
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		if ct := resp.Header.Get("Content-Type"); !isJSONContentType(ct) {
+			// Typically an HTML error page of a proxy in front of Open-WebUI.
+			log.Error(fmt.Errorf("Open-WebUI returned non-OK status"), "Upstream error with non-JSON body", "status_code", resp.StatusCode, "content_type", ct)
+			log.V(1).Info("Non-JSON upstream error body", "response_body", string(bodyBytes))
+			return nil, &chatUpstreamError{
+				status:  http.StatusBadGateway,
+				code:    "upstream_non_json_error",
+				message: fmt.Sprintf("Open-WebUI returned status %d with a non-JSON %s body", resp.StatusCode, ct),
+				err:     fmt.Errorf("Open-WebUI returned status %d", resp.StatusCode),
+			}
+		}
+		log.Error(fmt.Errorf("Open-WebUI returned non-OK status"), "Upstream error", "status_code", resp.StatusCode, "response_body", string(bodyBytes))
+		return nil, &chatUpstreamError{
+			status:  http.StatusBadGateway,
+			message: fmt.Sprintf("Open-WebUI Error (%d): %s", resp.StatusCode, string(bodyBytes)),
+			err:     fmt.Errorf("Open-WebUI returned status %d", resp.StatusCode),
+		}
+	}
+	return resp, nil
+}
+
+// fetchChatCompletion sends a buffered chat completion to Open-WebUI and parses
+// the message from its response.
+func (h *handler) fetchChatCompletion(ctx context.Context, newReq upstreamRequestFunc) (OpenWebUIChatResponse, error) {
+	log := logger.FromContext(ctx)
+	resp, err := h.sendChatRequest(ctx, newReq)
+	if err != nil {
+		return OpenWebUIChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	webuiRespBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err, "Failed to read WebUI response body")
+		return OpenWebUIChatResponse{}, &chatUpstreamError{status: http.StatusInternalServerError, message: "Failed to read WebUI response", err: err}
+	}
+
+	webuiResp, err := parseUpstreamChatResponse(webuiRespBody, h.Config.UpstreamResponseFormat)
+	if err != nil {
+		log.Error(err, "Invalid WebUI response format", "response_body", string(webuiRespBody))
+		return OpenWebUIChatResponse{}, &chatUpstreamError{status: http.StatusInternalServerError, message: "Invalid WebUI response format", err: err}
+	}
+	if webuiResp.Message.isEmpty() {
+		err := fmt.Errorf("Open-WebUI response contains no message")
+		log.Error(err, "Upstream error", "response_body", string(webuiRespBody))
+		return OpenWebUIChatResponse{}, &chatUpstreamError{status: http.StatusBadGateway, message: "Open-WebUI returned no usable message", err: err}
+	}
+	return webuiResp, nil
+}
+
+// writeChatError answers a failed upstream chat completion bounded by ctx.
+func (h *handler) writeChatError(w http.ResponseWriter, ctx context.Context, err error) {
+	if h.writeUpstreamTimeout(w, ctx, err) {
+		return
+	}
+	var chatErr *chatUpstreamError
+	if errors.As(err, &chatErr) {
+		if chatErr.code != "" {
+			writeOpenAIError(w, chatErr.status, "upstream_error", chatErr.code, chatErr.message)
+			return
+		}
+		http.Error(w, chatErr.message, chatErr.status)
+		return
+	}
+	writeConnError(w, err)
+}
+
+// isJSONContentType reports whether ct is a JSON media type. An absent
+// Content-Type is given the benefit of the doubt.
+func isJSONContentType(ct string) bool {
+	if ct == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestParseUpstreamChatResponse(t *testing.T) {
+	openWebUIBody := `{"message": {"role": "assistant", "content": "from open-webui"}, "status": "ok"}`
+	ollamaBody := `{"message": {"role": "assistant", "content": "from ollama"}, "prompt_eval_count": 3, "eval_count": 4}`
+	openAIBody := `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "from openai"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 5, "completion_tokens": 6, "total_tokens": 11}}`
+
+	tests := []struct {
+		name        string
+		format      string
+		body        string
+		wantContent string
+		wantTotal   int
+	}{
+		{"openwebui", upstreamFormatOpenWebUI, openWebUIBody, "from open-webui", 0},
+		{"ollama", upstreamFormatOllama, ollamaBody, "from ollama", 7},
+		{"openai", upstreamFormatOpenAI, openAIBody, "from openai", 11},
+		{"auto openwebui", upstreamFormatAuto, openWebUIBody, "from open-webui", 0},
+		{"auto ollama", upstreamFormatAuto, ollamaBody, "from ollama", 7},
+		{"auto openai", upstreamFormatAuto, openAIBody, "from openai", 11},
+		{"default is auto", "", openAIBody, "from openai", 11},
+		{"explicit format is not guessed", upstreamFormatOpenWebUI, openAIBody, "", 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := parseUpstreamChatResponse([]byte(tt.body), tt.format)
+			if err != nil {
+				t.Fatalf("Expected response to parse, got %v", err)
+			}
+			if resp.Message.Content != tt.wantContent {
+				t.Errorf("Expected content %q, got %q", tt.wantContent, resp.Message.Content)
+			}
+			if got := resp.tokenUsage().TotalTokens; got != tt.wantTotal {
+				t.Errorf("Expected %d total tokens, got %d", tt.wantTotal, got)
+			}
+		})
+	}
+}
+
+func TestParseUpstreamChatResponseInvalid(t *testing.T) {
+	for _, format := range []string{upstreamFormatAuto, upstreamFormatOpenWebUI, upstreamFormatOpenAI} {
+		if _, err := parseUpstreamChatResponse([]byte(`not json`), format); err == nil {
+			t.Errorf("Expected an error for invalid JSON with format %s", format)
+		}
+	}
+}
+
+func TestValidateUpstreamFormat(t *testing.T) {
+	for _, format := range []string{"", upstreamFormatAuto, upstreamFormatOpenWebUI, upstreamFormatOllama, upstreamFormatOpenAI} {
+		if err := validateUpstreamFormat(format); err != nil {
+			t.Errorf("Expected format %q to be valid, got %v", format, err)
+		}
+	}
+	if err := validateUpstreamFormat("anthropic"); err == nil {
+		t.Errorf("Expected an unknown format to be rejected")
+	}
+}
+
+func TestHandleChatCompletionsHTMLUpstreamError(t *testing.T) {
+	page := "<html><head><title>502 Bad Gateway</title></head><body><center><h1>502 Bad Gateway</h1></center><hr><center>nginx</center></body></html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	h := &handler{Config: &Config{OpenWebUIURL: ts.URL}}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "test-model", "messages": [{"role": "user", "content": "Hello"}]}`))
+	req = req.WithContext(logr.NewContext(context.Background(), logr.Discard()))
+	w := httptest.NewRecorder()
+	h.handleChatCompletions(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadGateway, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected an OpenAI-style JSON error, got Content-Type %q", ct)
+	}
+	if strings.Contains(w.Body.String(), "<html>") {
+		t.Errorf("Expected the HTML page not to be surfaced, got %s", w.Body.String())
+	}
+	var errResp OpenAIErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errResp.Error.Code != "upstream_non_json_error" || !strings.Contains(errResp.Error.Message, "non-JSON") {
+		t.Errorf("Unexpected error: %+v", errResp.Error)
+	}
+}
+
+func TestIsJSONContentType(t *testing.T) {
+	tests := map[string]bool{
+		"":                                true,
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/problem+json":        true,
+		"text/html; charset=utf-8":        false,
+		"text/plain":                      false,
+	}
+	for ct, want := range tests {
+		if got := isJSONContentType(ct); got != want {
+			t.Errorf("isJSONContentType(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
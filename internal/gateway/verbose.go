@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// debugHeader asks for verbose logging of a single request from a trusted source.
+const debugHeader = "X-Debug"
+
+// verboseSink raises the verbosity of a LogSink to V(1): V(1) messages are
+// passed to the wrapped sink at level 0 so that they are written regardless of
+// its configured verbosity.
+type verboseSink struct {
+	logr.LogSink
+}
+
+func (s verboseSink) Enabled(level int) bool {
+	return level <= 1 || s.LogSink.Enabled(level)
+}
+
+func (s verboseSink) Info(level int, msg string, keysAndValues ...any) {
+	if level <= 1 {
+		level = 0
+	}
+	s.LogSink.Info(level, msg, keysAndValues...)
+}
+
+func (s verboseSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return verboseSink{s.LogSink.WithValues(keysAndValues...)}
+}
+
+func (s verboseSink) WithName(name string) logr.LogSink {
+	return verboseSink{s.LogSink.WithName(name)}
+}
+
+// accessLog returns the logger of the routine per-request Info messages:
+// log itself, or log.V(1) with Config.Quiet so that they are only written at a
+// higher verbosity or for a request carrying debugHeader.
+func (h *handler) accessLog(log logr.Logger) logr.Logger {
+	if h.Config.Quiet {
+		return log.V(1)
+	}
+	return log
+}
+
+// withDebugHeader is a middleware that logs a request at V(1) when it carries
+// debugHeader and comes from one of Config.TrustedProxies, so a single request
+// can be traced without enabling verbose logging globally.
+func (h *handler) withDebugHeader(next http.HandlerFunc) http.HandlerFunc {
+	trusted, _ := parseTrustedProxies(h.Config.TrustedProxies)
+	if len(trusted) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if debug, _ := strconv.ParseBool(r.Header.Get(debugHeader)); !debug || !isTrusted(trusted, clientIP(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		log := logger.FromContext(r.Context())
+		if sink := log.GetSink(); sink != nil {
+			log = log.WithSink(verboseSink{sink})
+		}
+		log.V(1).Info("Verbose logging requested via header", "header", debugHeader)
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context(), log)))
+	}
+}
+
+// parseTrustedProxies parses IP addresses and CIDR ranges.
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP address or CIDR range", v)
+			}
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP address or CIDR range", v)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func isTrusted(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestDebugHeaderVerboseLogging(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenWebUIChatResponse{Message: MessageItem{Role: "assistant", Content: "Hi"}})
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, args)
+	}, funcr.Options{})
+
+	// httptest requests come from 192.0.2.1.
+	tests := []struct {
+		name    string
+		trusted []string
+		header  string
+		verbose bool
+	}{
+		{"trusted with header", []string{"192.0.2.0/24"}, "true", true},
+		{"trusted single address", []string{"192.0.2.1"}, "1", true},
+		{"trusted without header", []string{"192.0.2.0/24"}, "", false},
+		{"untrusted with header", []string{"10.0.0.0/8"}, "true", false},
+		{"no trusted proxies", nil, "true", false},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		logs = nil
+		mu.Unlock()
+
+		h := &handler{Config: &Config{OpenWebUIURL: upstream.URL, DefaultModel: "test-model", TrustedProxies: tt.trusted}}
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"messages": [{"role": "user", "content": "Hello"}]}`))
+		if tt.header != "" {
+			req.Header.Set("X-Debug", tt.header)
+		}
+		w := httptest.NewRecorder()
+		wrapLogger(log, h.withDebugHeader(h.handleRoot))(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected status code %d, got %d", tt.name, http.StatusOK, w.Code)
+		}
+		mu.Lock()
+		joined := strings.Join(logs, "\n")
+		mu.Unlock()
+		if got := strings.Contains(joined, "Applied default model"); got != tt.verbose {
+			t.Errorf("%s: Expected verbose logs %v, got logs:\n%s", tt.name, tt.verbose, joined)
+		}
+	}
+}
+
+func TestQuietLogging(t *testing.T) {
+	var unhealthy atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if r.URL.Path == "/health" && unhealthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, args)
+	}, funcr.Options{})
+	ctx := logr.NewContext(context.Background(), log)
+	cfg := &Config{OpenWebUIURL: upstream.URL, Quiet: true}
+	mainSrv, _ := setupServers(ctx, cfg, newHandler(cfg), make(chan struct{}), &sync.Once{})
+	send := func(path string) string {
+		mu.Lock()
+		logs = nil
+		mu.Unlock()
+		w := httptest.NewRecorder()
+		mainSrv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(logs, "\n")
+	}
+
+	if joined := send("/v1/embeddings"); joined != "" {
+		t.Errorf("Expected no routine logs in quiet mode, got:\n%s", joined)
+	}
+	joined := send("/v1/broken")
+	if !strings.Contains(joined, "Failed to forward request to upstream") {
+		t.Errorf("Expected errors to be logged in quiet mode, got:\n%s", joined)
+	}
+	if strings.Contains(joined, "Received request") {
+		t.Errorf("Expected routine logs to be suppressed alongside errors, got:\n%s", joined)
+	}
+
+	if joined := send("/healthz"); joined != "" {
+		t.Errorf("Expected no logs for a successful health check in quiet mode, got:\n%s", joined)
+	}
+	unhealthy.Store(true)
+	if joined := send("/healthz"); !strings.Contains(joined, "Health check warning") {
+		t.Errorf("Expected warnings to be logged in quiet mode, got:\n%s", joined)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.7 ", "::1"})
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	for addr, want := range map[string]bool{"10.1.2.3": true, "192.0.2.7": true, "192.0.2.8": false, "::1": true, "invalid": false} {
+		if got := isTrusted(trusted, addr); got != want {
+			t.Errorf("isTrusted(%q) = %v, want %v", addr, got, want)
+		}
+	}
+	if _, err := parseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected an error for an invalid trusted proxy")
+	}
+}
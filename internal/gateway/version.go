@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"fmt"
+
+	gw "github.com/norseto/openai-gateway"
+	"github.com/spf13/cobra"
+)
+
+// VersionString returns the release and git version of the gateway.
+func VersionString() string {
+	gitVersion := gw.GitVersion
+	if gitVersion == "" {
+		gitVersion = "unknown"
+	}
+	return fmt.Sprintf("%s (git: %s)", gw.RELEASE_VERSION, gitVersion)
+}
+
+// NewVersionCommand creates a new cobra command for printing the gateway version.
+func NewVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Prints the gateway version",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := fmt.Fprintf(cmd.OutOrStdout(), "openai-gateway %s\n", VersionString())
+			return err
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	gw "github.com/norseto/openai-gateway"
+)
+
+func TestVersionCommand(t *testing.T) {
+	orig := gw.GitVersion
+	gw.GitVersion = "abc1234"
+	defer func() { gw.GitVersion = orig }()
+
+	cmd := NewVersionCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected version command to succeed, got %v", err)
+	}
+	if !strings.Contains(out.String(), gw.RELEASE_VERSION) {
+		t.Errorf("Expected output to contain release version %s, got %q", gw.RELEASE_VERSION, out.String())
+	}
+	if !strings.Contains(out.String(), "abc1234") {
+		t.Errorf("Expected output to contain git version abc1234, got %q", out.String())
+	}
+}
+
+func TestVersionStringUnknownGitVersion(t *testing.T) {
+	orig := gw.GitVersion
+	gw.GitVersion = ""
+	defer func() { gw.GitVersion = orig }()
+
+	if v := VersionString(); !strings.Contains(v, "git: unknown") {
+		t.Errorf("Expected unknown git version, got %q", v)
+	}
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/norseto/k8s-watchdogs/pkg/logger"
+)
+
+// shutdownWebhookTimeout bounds the shutdown webhook call so that it cannot
+// hold up the exit of the gateway.
+const shutdownWebhookTimeout = 5 * time.Second
+
+// shutdownEvent is the JSON payload posted to Config.ShutdownWebhook.
+type shutdownEvent struct {
+	Reason         string  `json:"reason"`
+	UptimeSec      float64 `json:"uptime_sec"`
+	RequestsServed int64   `json:"requests_served"`
+}
+
+// validateShutdownWebhook reports an error if webhook is set but not an
+// absolute http or https URL.
+func validateShutdownWebhook(webhook string) error {
+	if webhook == "" {
+		return nil
+	}
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return fmt.Errorf("invalid shutdown webhook: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid shutdown webhook %q: must be an absolute http or https URL", u.Redacted())
+	}
+	return nil
+}
+
+// notifyShutdown posts event to webhook. Failures are logged only, since the
+// gateway exits either way.
+func notifyShutdown(ctx context.Context, webhook string, event shutdownEvent) {
+	log := logger.FromContext(ctx)
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Error(err, "Failed to encode shutdown webhook payload")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Error(err, "Failed to create shutdown webhook request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Error(err, "Failed to call shutdown webhook")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Info("Shutdown webhook returned non-success status", "status_code", resp.StatusCode)
+		return
+	}
+	log.Info("Shutdown webhook notified", "reason", event.Reason)
+}
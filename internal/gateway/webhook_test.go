@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestShutdownWebhook(t *testing.T) {
+	events := make(chan shutdownEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event shutdownEvent
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON POST, got %s with %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+		events <- event
+	}))
+	defer webhook.Close()
+
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	socket := filepath.Join(shortTempDir(t), "quit.sock")
+	cfg := &Config{
+		OpenWebUIURL:       "http://dummy-url",
+		QuitSocket:         socket,
+		ShutdownTimeoutSec: 1,
+		ShutdownWebhook:    webhook.URL,
+	}
+	done := make(chan error, 1)
+	go func() { done <- processServe(ctx, cfg) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the quit socket %s", socket)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cmd := NewQuitCommand()
+	cmd.SetContext(ctx)
+	cmd.SetArgs([]string{"--quit-socket", socket})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected the quit command to succeed, got %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the gateway to shut down")
+	}
+	select {
+	case event := <-events:
+		if event.Reason != "quit endpoint" || event.UptimeSec <= 0 || event.RequestsServed != 0 {
+			t.Errorf("Unexpected shutdown event %+v", event)
+		}
+	default:
+		t.Fatal("Expected the shutdown webhook to be called before processServe returned")
+	}
+}
+
+func TestValidateShutdownWebhook(t *testing.T) {
+	for webhook, ok := range map[string]bool{
+		"":                        true,
+		"https://hooks.example/x": true,
+		"http://127.0.0.1:9/hook": true,
+		"ftp://hooks.example/x":   false,
+		"/relative":               false,
+	} {
+		if err := validateShutdownWebhook(webhook); (err == nil) != ok {
+			t.Errorf("validateShutdownWebhook(%q) = %v, want ok=%v", webhook, err, ok)
+		}
+	}
+}